@@ -1,13 +1,7 @@
 package main
 
-import (
-	"log"
-
-	"ms-ride-sharing/services/api-gateway/internal/config"
-)
+import "ms-ride-sharing/services/api-gateway/internal/config"
 
 func main() {
-	log.Println("Starting API Gateway")
-
 	config.ConfigServer()
 }
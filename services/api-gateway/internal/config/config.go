@@ -1,23 +1,123 @@
 package config
 
-import "ms-ride-sharing/shared/env"
+import (
+	"errors"
+	"fmt"
+	"ms-ride-sharing/shared/env"
+	"ms-ride-sharing/shared/mtls"
+	"ms-ride-sharing/shared/tracing"
+	"time"
+)
 
 type Config struct {
-	Environment string
-	Port        string
-	JWTSecret   string
-	UserSvcAddr string
-	RedisHost   string
-	RedisPort   string
+	Environment string `env:"ENVIRONMENT" default:"development"`
+	Port        string `env:"API_GATEWAY_PORT" default:"8080"`
+	JWTSecret   string `env:"JWT_SECRET" default:"um-secret-mto-dificil" secret:"true"`
+	RedisHost   string `env:"REDIS_HOST" default:"localhost"`
+	RedisPort   string `env:"REDIS_PORT" default:"6379"`
+	AdminPort   string `env:"ADMIN_PORT" default:"9090"`
+
+	// InternalTokenSecret signs the identity forwarded to upstreams.
+	InternalTokenSecret string        `env:"INTERNAL_TOKEN_SECRET" default:"segredo-interno-dev" secret:"true"`
+	InternalTokenTTL    time.Duration `env:"INTERNAL_TOKEN_TTL" default:"30s"`
+
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" default:"5s"`
+	DrainTimeout        time.Duration `env:"DRAIN_TIMEOUT" default:"5s"`
+
+	TracingExporter    string  `env:"TRACING_EXPORTER" default:"none"`
+	OTLPEndpoint       string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"otel-collector:4317"`
+	OTLPInsecure       bool    `env:"OTEL_EXPORTER_OTLP_INSECURE" default:"true"`
+	TracingFile        string  `env:"TRACING_FILE" default:"traces.json"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1"`
+
+	UpstreamsConfigPath     string        `env:"UPSTREAMS_CONFIG_PATH"`
+	UpstreamMaxAttempts     int           `env:"UPSTREAM_MAX_ATTEMPTS" default:"3"`
+	BreakerFailureThreshold int           `env:"BREAKER_FAILURE_THRESHOLD" default:"5"`
+	BreakerOpenTimeout      time.Duration `env:"BREAKER_OPEN_TIMEOUT" default:"10s"`
+
+	// Deprecated: set the addresses of user-service in the upstreams file.
+	// When set, it still overrides them.
+	UserSvcAddr string `env:"USER_SERVICE_ADDR"`
+
+	TLSCertFile       string        `env:"GRPC_TLS_CERT_FILE"`
+	TLSKeyFile        string        `env:"GRPC_TLS_KEY_FILE"`
+	TLSCAFile         string        `env:"GRPC_TLS_CA_FILE"`
+	TLSReloadInterval time.Duration `env:"GRPC_TLS_RELOAD_INTERVAL" default:"1m"`
+
+	SessionCacheSize int           `env:"SESSION_CACHE_SIZE" default:"10000"`
+	SessionCacheTTL  time.Duration `env:"SESSION_CACHE_TTL" default:"5s"`
+
+	IdempotencyTTL     time.Duration `env:"IDEMPOTENCY_TTL" default:"24h"`
+	IdempotencyLockTTL time.Duration `env:"IDEMPOTENCY_LOCK_TTL" default:"1m"`
+
+	// WebSocket limits; the connection cap is per user on each replica.
+	WSIdleTimeout     time.Duration `env:"WS_IDLE_TIMEOUT" default:"60s"`
+	WSWriteTimeout    time.Duration `env:"WS_WRITE_TIMEOUT" default:"10s"`
+	WSMaxMessageBytes int64         `env:"WS_MAX_MESSAGE_BYTES" default:"65536"`
+	WSMaxConnsPerUser int           `env:"WS_MAX_CONNECTIONS_PER_USER" default:"5"`
+
+	// HTTP server timeouts. WriteTimeout must exceed the longest route
+	// timeout; server streams, REST or gRPC-Web and Connect, and WebSockets
+	// are exempt from it.
+	HTTPReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" default:"5s"`
+	HTTPReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" default:"30s"`
+	HTTPWriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT" default:"60s"`
+	HTTPIdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" default:"120s"`
+	HTTPMaxHeaderBytes    int           `env:"HTTP_MAX_HEADER_BYTES" default:"65536"`
+
+	// Request bodies must be JSON and may only carry fields the RPC declares.
+	StrictContentType   bool `env:"STRICT_CONTENT_TYPE" default:"true"`
+	RejectUnknownFields bool `env:"REJECT_UNKNOWN_FIELDS" default:"true"`
+
+	TrustForwardedFor bool          `env:"TRUST_FORWARDED_FOR" default:"false"`
+	RateLimitTimeout  time.Duration `env:"RATE_LIMIT_REDIS_TIMEOUT" default:"50ms"`
+	RateLimitCooldown time.Duration `env:"RATE_LIMIT_REDIS_COOLDOWN" default:"5s"`
+
+	RuntimeConfigPath     string        `env:"RUNTIME_CONFIG_PATH"`
+	RuntimeReloadInterval time.Duration `env:"RUNTIME_CONFIG_RELOAD_INTERVAL" default:"10s"`
 }
 
-func LoadConfig() *Config {
-	return &Config{
-		Environment: env.GetString("ENVIRONMENT", "development"),
-		Port:        env.GetString("API_GATEWAY_PORT", "8080"),
-		JWTSecret:   env.GetString("JWT_SECRET", "um-secret-mto-dificil"),
-		UserSvcAddr: env.GetString("USER_SERVICE_ADDR", "user-service:9091"),
-		RedisHost:   env.GetString("REDIS_HOST", "localhost"),
-		RedisPort:   env.GetString("REDIS_PORT", "6379"),
+func (c *Config) Tracing() tracing.Config {
+	return tracing.Config{
+		ServiceName:  "api-gateway",
+		Environment:  c.Environment,
+		Exporter:     c.TracingExporter,
+		OTLPEndpoint: c.OTLPEndpoint,
+		OTLPInsecure: c.OTLPInsecure,
+		FilePath:     c.TracingFile,
+		SampleRatio:  c.TracingSampleRatio,
+	}
+}
+
+// TLS is the client certificate presented to upstreams with tls enabled.
+func (c *Config) TLS() mtls.Config {
+	return mtls.Config{
+		CertFile: c.TLSCertFile,
+		KeyFile:  c.TLSKeyFile,
+		CAFile:   c.TLSCAFile,
+	}
+}
+
+func (c *Config) Validate() error {
+	if err := c.TLS().Validate(); err != nil {
+		return fmt.Errorf("GRPC_TLS: %w", err)
 	}
+	// Without a header timeout a client can hold a connection open forever
+	// by sending its headers slowly.
+	if c.HTTPReadHeaderTimeout <= 0 {
+		return fmt.Errorf("HTTP_READ_HEADER_TIMEOUT must be positive, got %s", c.HTTPReadHeaderTimeout)
+	}
+	if c.HTTPReadTimeout < 0 || c.HTTPWriteTimeout < 0 || c.HTTPIdleTimeout < 0 {
+		return errors.New("HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT must not be negative")
+	}
+	if c.HTTPMaxHeaderBytes <= 0 {
+		return fmt.Errorf("HTTP_MAX_HEADER_BYTES must be positive, got %d", c.HTTPMaxHeaderBytes)
+	}
+	return nil
+}
+
+func LoadConfig() *Config {
+	config := &Config{}
+	env.MustLoad(config, env.WithFile(env.GetString("CONFIG_FILE", "")))
+	return config
 }
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"ms-ride-sharing/services/api-gateway/internal/cors"
+	"ms-ride-sharing/services/api-gateway/internal/policy"
+	"ms-ride-sharing/services/api-gateway/internal/ratelimit"
+	"ms-ride-sharing/services/api-gateway/internal/realtime"
+	"ms-ride-sharing/shared/authz"
+	"time"
+)
+
+// Runtime holds the settings that can change without a restart. It is read
+// from the file at RUNTIME_CONFIG_PATH, usually a mounted ConfigMap.
+type Runtime struct {
+	// DefaultPolicy applies to every registered route without an entry in
+	// Routes. Routes are keyed by METHOD:/template, e.g. GET:/api/v1/rides/{id}.
+	// Who may call a route is not configured here but declared on the RPC
+	// with the (ridesharing.auth) option.
+	DefaultPolicy policy.Policy              `yaml:"default_policy"`
+	Routes        map[string]policy.Policy   `yaml:"routes"`
+	RateLimits    map[string]ratelimit.Limit `yaml:"rate_limits"`
+	CORS          cors.Config                `yaml:"cors"`
+	LogLevel      string                     `yaml:"log_level"`
+}
+
+// DefaultRuntime allows any origin in development only; other environments
+// must list their origins in the runtime config.
+func DefaultRuntime(environment string) Runtime {
+	var origins []string
+	if environment == "development" {
+		origins = []string{"*"}
+	}
+
+	return Runtime{
+		DefaultPolicy: policy.Policy{
+			RateLimit:    "default",
+			MaxBodyBytes: 1 << 20,
+			Timeout:      10 * time.Second,
+		},
+		Routes: map[string]policy.Policy{
+			"POST:/api/v1/users":               {RateLimit: "signup", MaxBodyBytes: 4 << 10},
+			"POST:/api/v1/users/login":         {RateLimit: "auth", MaxBodyBytes: 4 << 10, Sensitive: true},
+			"POST:/api/v1/users/refresh-token": {RateLimit: "auth", MaxBodyBytes: 4 << 10, Sensitive: true},
+			"POST:/api/v1/auth/ws-ticket":      {RateLimit: "auth", MaxBodyBytes: 1 << 10, Sensitive: true},
+		},
+		RateLimits: map[string]ratelimit.Limit{
+			"default": {Rate: 100, Period: time.Minute, Burst: 20},
+			"signup":  {Rate: 5, Period: time.Minute},
+			"auth":    {Rate: 10, Period: time.Minute},
+			// Every request, per client IP, before authentication.
+			ratelimit.ClientIPClass: {Rate: 600, Period: time.Minute, Burst: 100},
+			// WebSocket handshakes; the default class of every WebSocket route.
+			realtime.DefaultRateLimit: {Rate: 10, Period: time.Minute, Burst: 5},
+		},
+		CORS: cors.Config{
+			AllowedOrigins: origins,
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{
+				"Authorization", "Content-Type", "Idempotency-Key", "X-Request-ID",
+				// Sent by gRPC-Web and Connect clients.
+				"Connect-Protocol-Version", "Connect-Timeout-Ms", "Grpc-Timeout", "X-Grpc-Web", "X-User-Agent",
+			},
+			ExposedHeaders: []string{
+				"X-Request-ID", "Retry-After", "Idempotent-Replayed",
+				"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+			},
+			MaxAge: 10 * time.Minute,
+		},
+		LogLevel: "info",
+	}
+}
+
+// Validate checks everything that does not depend on the routes registered
+// on the gateway; policy.Table.Store checks the rest.
+func (r *Runtime) Validate() error {
+	for class, limit := range r.RateLimits {
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("rate_limits[%s]: %w", class, err)
+		}
+	}
+
+	hasClass := func(class string) bool {
+		_, ok := r.RateLimits[class]
+		return ok
+	}
+
+	if err := r.DefaultPolicy.Validate(hasClass); err != nil {
+		return fmt.Errorf("default_policy: %w", err)
+	}
+	for route, p := range r.Routes {
+		if _, err := authz.NormalizeRoute(route); err != nil {
+			return fmt.Errorf("routes: %w", err)
+		}
+		if err := p.Validate(hasClass); err != nil {
+			return fmt.Errorf("routes[%s]: %w", route, err)
+		}
+	}
+
+	if err := r.CORS.Validate(); err != nil {
+		return fmt.Errorf("cors: %w", err)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(r.LogLevel)); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+
+	return nil
+}
@@ -3,76 +3,281 @@ package config
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"ms-ride-sharing/shared/jwt"
+	"ms-ride-sharing/shared/logger"
+	"ms-ride-sharing/shared/metrics"
+	"ms-ride-sharing/shared/requestid"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"ms-ride-sharing/services/api-gateway/internal/cors"
+	"ms-ride-sharing/services/api-gateway/internal/docs"
 	httpHandler "ms-ride-sharing/services/api-gateway/internal/handlers"
-	userpb "ms-ride-sharing/shared/proto/v1/user"
+	"ms-ride-sharing/services/api-gateway/internal/idempotency"
+	"ms-ride-sharing/services/api-gateway/internal/policy"
+	"ms-ride-sharing/services/api-gateway/internal/ratelimit"
+	"ms-ride-sharing/services/api-gateway/internal/realtime"
+	"ms-ride-sharing/services/api-gateway/internal/session"
+	"ms-ride-sharing/services/api-gateway/internal/upstream"
+	"ms-ride-sharing/shared/admin"
+	"ms-ride-sharing/shared/authz"
+	"ms-ride-sharing/shared/env"
+	"ms-ride-sharing/shared/grpcx"
+	"ms-ride-sharing/shared/health"
+	"ms-ride-sharing/shared/mtls"
+	"ms-ride-sharing/shared/openapi"
+	"ms-ride-sharing/shared/runtimeconfig"
+	"ms-ride-sharing/shared/tracing"
+	"ms-ride-sharing/shared/types"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func ConfigServer() {
-	log.Println("registering gRPC service with gRPC-Gateway")
 	configData := LoadConfig()
+	logger.Setup("api-gateway", configData.Environment)
+	slog.Info("starting API gateway")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), configData.Tracing())
+	if err != nil {
+		logger.Fatal("failed to set up tracing", logger.Err(err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("error flushing traces", logger.Err(err))
+		}
+	}()
+	slog.Info("registering gRPC service with gRPC-Gateway")
+
+	runtimeCfg, err := runtimeconfig.New(configData.RuntimeConfigPath, DefaultRuntime(configData.Environment))
+	if err != nil {
+		logger.Fatal("failed to load runtime config", logger.Err(err))
+	}
+
+	upstreamConfigs, err := upstream.LoadConfigs(configData.UpstreamsConfigPath, DefaultUpstreams())
+	if err != nil {
+		logger.Fatal("failed to load upstreams", logger.Err(err))
+	}
+	if err := applyUserServiceAddr(upstreamConfigs, configData.UserSvcAddr); err != nil {
+		logger.Fatal("failed to load upstreams", logger.Err(err))
+	}
+	var certs *mtls.Source
+	if configData.TLS().Enabled() {
+		certs, err = mtls.NewSource(configData.TLS())
+		if err != nil {
+			logger.Fatal("failed to load tls certificates", logger.Err(err))
+		}
+	}
+
+	retry := grpcx.DefaultRetryPolicy()
+	retry.MaxAttempts = configData.UpstreamMaxAttempts
+	upstreams, err := upstream.NewRegistry(upstreamConfigs, services, upstream.Options{
+		Retry:            retry,
+		FailureThreshold: configData.BreakerFailureThreshold,
+		OpenTimeout:      configData.BreakerOpenTimeout,
+		Certs:            certs,
+		DialOptions:      []grpc.DialOption{grpc.WithStatsHandler(otelgrpc.NewClientHandler())},
+	})
+	if err != nil {
+		logger.Fatal("failed to create upstreams", logger.Err(err))
+	}
+	defer upstreams.Close()
+
+	// The registry must cover the same proto files registered on gwmux below,
+	// so that every route gets a policy.
+	registry := authz.NewRegistry(upstreams.Files()...)
+	if err := registry.Validate(types.Roles()); err != nil {
+		logger.Fatal("invalid auth rules", logger.Err(err))
+	}
+	wsRoutes, err := realtime.LoadRoutes(configData.UpstreamsConfigPath)
+	if err != nil {
+		logger.Fatal("failed to load websocket routes", logger.Err(err))
+	}
+	if err := realtime.ValidateRoutes(wsRoutes, types.Roles(), certs != nil); err != nil {
+		logger.Fatal("invalid websocket routes", logger.Err(err))
+	}
+	policies := policy.NewTable(registry)
+	apiSpec, err := docs.Build(openapi.Specs, upstreams.Files(), registry)
+	if err != nil {
+		logger.Fatal("failed to build openapi spec", logger.Err(err))
+	}
+	corsRules, err := cors.NewRules(runtimeCfg.Get().CORS)
+	if err != nil {
+		logger.Fatal("invalid cors policy", logger.Err(err))
+	}
+	rateLimits := ratelimit.NewRules(runtimeCfg.Get().RateLimits)
+	subscribeRuntime(runtimeCfg, policies, corsRules, rateLimits)
 
 	jwtSvc := jwt.NewJWTService(configData.JWTSecret)
+	identities := authz.NewSigner(configData.InternalTokenSecret, "api-gateway", configData.InternalTokenTTL)
 	rdbRepo := redis.NewClient(&redis.Options{
 		Addr: fmt.Sprintf("%s:%s", configData.RedisHost, configData.RedisPort),
 	})
+	if err := redisotel.InstrumentTracing(rdbRepo, redisotel.WithDBStatement(false)); err != nil {
+		logger.Fatal("failed to instrument redis", logger.Err(err))
+	}
+	if err := metrics.RegisterRedisPool("gateway", rdbRepo); err != nil {
+		logger.Fatal("failed to register redis metrics", logger.Err(err))
+	}
+
+	sessions := session.NewValidator(rdbRepo, configData.SessionCacheSize, configData.SessionCacheTTL)
+
+	limiter := ratelimit.NewFallbackLimiter(
+		ratelimit.NewRedisLimiter(rdbRepo),
+		ratelimit.NewLocalLimiter(),
+		configData.RateLimitTimeout,
+		configData.RateLimitCooldown,
+	)
+
+	wsProxy := realtime.NewProxy(realtime.Limits{
+		IdleTimeout:     configData.WSIdleTimeout,
+		MaxMessageBytes: configData.WSMaxMessageBytes,
+		MaxConnsPerUser: configData.WSMaxConnsPerUser,
+		WriteTimeout:    configData.WSWriteTimeout,
+	}, certs)
 
+	authenticate := httpHandler.Authenticate(jwtSvc, sessions)
+	clientIPLimit := httpHandler.RateLimitClientIP(limiter, rateLimits, ratelimit.ClientIPClass, configData.TrustForwardedFor)
+	routeLimit := httpHandler.RateLimit(limiter, rateLimits, configData.TrustForwardedFor)
+	middlewares := []runtime.Middleware{
+		httpHandler.RouteTemplate,
+		httpHandler.RoutePolicy(policies, policy.ServerStreamRoutes(upstreams.Files()...)),
+	}
+	if configData.StrictContentType {
+		middlewares = append(middlewares, httpHandler.RequireJSON)
+	}
+	middlewares = append(middlewares,
+		clientIPLimit,
+		authenticate,
+		routeLimit,
+		httpHandler.Idempotency(idempotency.NewStore(rdbRepo, configData.IdempotencyTTL, configData.IdempotencyLockTTL), configData.TrustForwardedFor),
+		httpHandler.StreamWebSocket(wsProxy, realtime.StreamRoutes(upstreams.Files()...), configData.TrustForwardedFor),
+	)
 	gwmux := runtime.NewServeMux(
 		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
 			MarshalOptions: protojson.MarshalOptions{
 				UseEnumNumbers:  false,
 				EmitUnpopulated: true,
 			},
+			UnmarshalOptions: protojson.UnmarshalOptions{
+				DiscardUnknown: !configData.RejectUnknownFields,
+			},
 		}),
+		runtime.WithErrorHandler(httpHandler.ProblemErrorHandler),
+		runtime.WithIncomingHeaderMatcher(httpHandler.IncomingHeaderMatcher),
+		runtime.WithMiddlewares(middlewares...),
 		runtime.WithMetadata(func(ctx context.Context, req *http.Request) metadata.MD {
-			if userID, ok := req.Context().Value("user_id").(string); ok {
-				return metadata.Pairs("x-user-id", userID)
+			requestID := requestid.FromContext(req.Context())
+			md := metadata.Pairs(requestid.MetadataKey, requestID)
+			userID, ok := httpHandler.UserIDFromContext(req.Context())
+			if !ok {
+				return md
 			}
-			return nil
+			role, _ := httpHandler.RoleFromContext(req.Context())
+			token, err := identities.Sign(authz.Identity{UserID: userID, Role: role}, requestID)
+			if err != nil {
+				// The upstream answers Unauthenticated for calls that need it.
+				slog.ErrorContext(req.Context(), "failed to sign internal identity", logger.Err(err))
+				return md
+			}
+			md.Set(authz.IdentityMetadataKey, token)
+			return md
 		}),
 	)
 
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
-
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	err := userpb.RegisterUserServiceHandlerFromEndpoint(ctx, gwmux, configData.UserSvcAddr, opts)
-	if err != nil {
-		log.Fatalf("failed to register user grpc service : %v", err)
+	go runtimeCfg.Watch(ctx, configData.RuntimeReloadInterval)
+	go sessions.Listen(ctx)
+	if certs != nil {
+		go certs.Watch(ctx, configData.TLSReloadInterval)
 	}
 
+	adminServer := admin.NewServer(fmt.Sprintf(":%s", configData.AdminPort))
+	adminServer.Handle("/admin/config", runtimeCfg.Handler())
+	adminServer.Handle("/admin/routes", httpHandler.RoutePolicies(policies))
+
+	if err := upstreams.Register(ctx, gwmux); err != nil {
+		logger.Fatal("failed to register upstream services", logger.Err(err))
+	}
+
+	healthMonitor := health.NewMonitor(
+		configData.HealthCheckInterval,
+		append(upstreams.Checks(), health.RedisCheck(rdbRepo))...,
+	)
+	go healthMonitor.Run(ctx)
+
+	var draining atomic.Bool
+	adminServer.Handle("/status", httpHandler.Status(healthMonitor))
+	adminServer.Handle("/metrics", metrics.Handler())
+	adminServer.Start()
+
 	mainMux := http.NewServeMux()
+	mainMux.HandleFunc("GET /healthz", httpHandler.Healthz)
+	mainMux.Handle("GET /readyz", httpHandler.Readyz(healthMonitor, &draining))
+	mainMux.Handle("GET /openapi.json", httpHandler.OpenAPI(apiSpec))
+	if configData.Environment != env.Production {
+		mainMux.Handle("GET /docs/", httpHandler.Docs("/docs/"))
+	}
 
 	protectedGateway := httpHandler.Chain(
+		httpHandler.Tracing,
+		httpHandler.RequestID,
+		httpHandler.Metrics,
 		httpHandler.Logger,
 		httpHandler.Recoverer,
-		httpHandler.CORS,
-		// httpHandler.AuthMiddleware(jwtSvc, rdb),
-		httpHandler.AuthMiddleware(jwtSvc, rdbRepo),
+		httpHandler.CORS(corsRules),
+		httpHandler.StreamBridge(corsRules),
 	)(gwmux)
 
 	serverAddr := fmt.Sprintf(":%s", configData.Port)
 	mainMux.Handle("/", protectedGateway)
 
+	// Metrics is left out: connection lifetimes would skew request
+	// latencies, and the proxy reports its own metrics.
+	websocketChain := httpHandler.Chain(
+		httpHandler.Tracing,
+		httpHandler.RequestID,
+		httpHandler.Logger,
+		httpHandler.Recoverer,
+	)
+	wsGuard := func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return clientIPLimit(authenticate(routeLimit(next)))
+	}
+	for _, route := range wsRoutes {
+		if _, ok := rateLimits.Lookup(route.RateLimit); !ok {
+			slog.Warn("websocket route has no rate limit",
+				slog.String("path", route.Path), slog.String("rate_limit", route.RateLimit))
+		}
+		mainMux.Handle("GET "+route.Path, websocketChain(
+			httpHandler.WebSocket(route, wsProxy, wsGuard, corsRules, identities, configData.TrustForwardedFor),
+		))
+	}
+
 	server := &http.Server{
-		Addr:    serverAddr,
-		Handler: mainMux,
+		Addr:              serverAddr,
+		Handler:           mainMux,
+		ReadHeaderTimeout: configData.HTTPReadHeaderTimeout,
+		ReadTimeout:       configData.HTTPReadTimeout,
+		WriteTimeout:      configData.HTTPWriteTimeout,
+		IdleTimeout:       configData.HTTPIdleTimeout,
+		MaxHeaderBytes:    configData.HTTPMaxHeaderBytes,
 	}
 
 	serverErrors := make(chan error, 1)
@@ -80,20 +285,62 @@ func ConfigServer() {
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Server listening on %s", serverAddr)
+		slog.Info("server listening", slog.String("addr", serverAddr))
 		serverErrors <- server.ListenAndServe()
 	}()
 
 	select {
 	case err := <-serverErrors:
-		log.Printf("Error starting the server: %v", err)
+		slog.Error("error starting the server", logger.Err(err))
 	case sig := <-shutdown:
-		log.Printf("Server is shutting down due to %v signal", sig)
+		slog.Info("server is shutting down", slog.String("signal", sig.String()))
+
+		// Fail readiness first so the load balancer stops sending traffic
+		// before the listener is closed.
+		draining.Store(true)
+		slog.Info("draining connections", slog.Duration("timeout", configData.DrainTimeout))
+		time.Sleep(configData.DrainTimeout)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
+		// Hijacked connections are not tracked by server.Shutdown; tell
+		// WebSocket clients to reconnect elsewhere first.
+		if err := wsProxy.Shutdown(ctx); err != nil {
+			slog.Error("could not close websocket connections gracefully", logger.Err(err))
+		}
 		if err := server.Shutdown(ctx); err != nil {
-			log.Printf("Could not stop server gracefully: %v", err)
+			slog.Error("could not stop server gracefully", logger.Err(err))
 			server.Close()
 		}
+		if err := adminServer.Shutdown(ctx); err != nil {
+			slog.Error("could not stop admin server gracefully", logger.Err(err))
+		}
+	}
+}
+
+func subscribeRuntime(store *runtimeconfig.Store[Runtime], policies *policy.Table, corsRules *cors.Rules, rateLimits *ratelimit.Rules) {
+	subscriptions := []struct {
+		keys  []string
+		apply runtimeconfig.ApplyFunc[Runtime]
+	}{
+		{[]string{"default_policy", "routes"}, func(_, next *Runtime) error {
+			return policies.Store(next.DefaultPolicy, next.Routes)
+		}},
+		{[]string{"cors"}, func(_, next *Runtime) error {
+			return corsRules.Store(next.CORS)
+		}},
+		{[]string{"rate_limits"}, func(_, next *Runtime) error {
+			rateLimits.Store(next.RateLimits)
+			return nil
+		}},
+		{[]string{"log_level"}, func(_, next *Runtime) error {
+			return logger.SetLevel(next.LogLevel)
+		}},
+	}
+
+	for _, sub := range subscriptions {
+		if err := store.Subscribe(sub.apply, sub.keys...); err != nil {
+			logger.Fatal("failed to apply runtime config", slog.String("keys", strings.Join(sub.keys, ",")), logger.Err(err))
+		}
 	}
 }
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"ms-ride-sharing/services/api-gateway/internal/upstream"
+	userpb "ms-ride-sharing/shared/proto/v1/user"
+)
+
+// services lists every proto service the gateway knows how to expose. A new
+// backend is added here and then pointed at in the upstreams file.
+var services = map[string]upstream.Service{
+	"ridesharing.v1.UserService": {
+		File:     userpb.File_user_user_proto,
+		Register: userpb.RegisterUserServiceHandler,
+	},
+}
+
+// DefaultUpstreams is used when UPSTREAMS_CONFIG_PATH is not set.
+func DefaultUpstreams() []upstream.Config {
+	return []upstream.Config{
+		{
+			Name:      "user-service",
+			Addresses: []string{"user-service:9091"},
+			Services:  []string{"ridesharing.v1.UserService"},
+		},
+	}
+}
+
+// applyUserServiceAddr honours the deprecated USER_SERVICE_ADDR, which
+// predates the upstreams file, as an override of the user-service upstream.
+func applyUserServiceAddr(configs []upstream.Config, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	for i := range configs {
+		if configs[i].Name == "user-service" {
+			slog.Warn("USER_SERVICE_ADDR is deprecated, set the user-service addresses in the upstreams file",
+				slog.String("addr", addr))
+			configs[i].Addresses = []string{addr}
+			return nil
+		}
+	}
+	return fmt.Errorf("USER_SERVICE_ADDR is set but no upstream is named user-service")
+}
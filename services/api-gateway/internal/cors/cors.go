@@ -0,0 +1,218 @@
+package cors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config is the cross-origin policy of the gateway.
+type Config struct {
+	// AllowedOrigins are exact origins (https://app.example.com), subdomain
+	// patterns (https://*.example.com) or "*" for any origin.
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// MarshalJSON renders MaxAge as a duration string in the effective config.
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"allowed_origins":   c.AllowedOrigins,
+		"allowed_methods":   c.AllowedMethods,
+		"allowed_headers":   c.AllowedHeaders,
+		"exposed_headers":   c.ExposedHeaders,
+		"allow_credentials": c.AllowCredentials,
+		"max_age":           c.MaxAge.String(),
+	})
+}
+
+func (c Config) Validate() error {
+	_, err := compile(c)
+	return err
+}
+
+// Policy is a compiled Config.
+type Policy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	patterns    []originPattern
+	methods     []string
+	headers     map[string]bool
+	credentials bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// originPattern matches https://*.example.com: any subdomain, at any depth,
+// with the same scheme and port.
+type originPattern struct {
+	prefix string // "https://"
+	suffix string // ".example.com"
+}
+
+func compile(c Config) (*Policy, error) {
+	p := &Policy{
+		origins:     map[string]bool{},
+		headers:     map[string]bool{},
+		credentials: c.AllowCredentials,
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			pattern, err := parsePattern(origin)
+			if err != nil {
+				return nil, err
+			}
+			p.patterns = append(p.patterns, pattern)
+		default:
+			if err := checkOrigin(origin); err != nil {
+				return nil, err
+			}
+			p.origins[origin] = true
+		}
+	}
+	if p.anyOrigin && p.credentials {
+		return nil, errors.New(`allow_credentials cannot be combined with the "*" origin`)
+	}
+
+	for _, method := range c.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" || method == "*" {
+			return nil, fmt.Errorf("invalid method %q; list methods explicitly", method)
+		}
+		p.methods = append(p.methods, method)
+	}
+
+	var headers []string
+	for _, header := range c.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "" || header == "*" {
+			return nil, fmt.Errorf("invalid header %q; list headers explicitly", header)
+		}
+		p.headers[strings.ToLower(header)] = true
+		headers = append(headers, header)
+	}
+
+	if c.MaxAge < 0 {
+		return nil, fmt.Errorf("max_age must not be negative, got %s", c.MaxAge)
+	}
+
+	p.allowMethods = strings.Join(p.methods, ", ")
+	p.allowHeaders = strings.Join(headers, ", ")
+	p.exposeHeaders = strings.Join(c.ExposedHeaders, ", ")
+	p.maxAge = strconv.Itoa(int(c.MaxAge.Seconds()))
+	return p, nil
+}
+
+func checkOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+		return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	return nil
+}
+
+func parsePattern(origin string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(origin, "://*.")
+	if !ok || strings.Contains(rest, "*") {
+		return originPattern{}, fmt.Errorf("invalid origin pattern %q, expected scheme://*.domain", origin)
+	}
+	if err := checkOrigin(scheme + "://" + rest); err != nil {
+		return originPattern{}, err
+	}
+	return originPattern{prefix: scheme + "://", suffix: "." + rest}, nil
+}
+
+// AllowsOrigin reports whether origin may make cross-origin requests.
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if strings.HasPrefix(origin, pattern.prefix) && strings.HasSuffix(origin, pattern.suffix) &&
+			len(origin) > len(pattern.prefix)+len(pattern.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) AllowsMethod(method string) bool {
+	return slices.Contains(p.methods, method)
+}
+
+// AllowsHeaders checks the comma separated Access-Control-Request-Headers
+// of a preflight.
+func (p *Policy) AllowsHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowOrigin is the Access-Control-Allow-Origin value for an allowed
+// origin. "*" is only sent without credentials, where browsers accept it.
+func (p *Policy) AllowOrigin(origin string) string {
+	if p.anyOrigin && !p.credentials {
+		return "*"
+	}
+	return origin
+}
+
+func (p *Policy) Credentials() bool     { return p.credentials }
+func (p *Policy) AllowMethods() string  { return p.allowMethods }
+func (p *Policy) AllowHeaders() string  { return p.allowHeaders }
+func (p *Policy) ExposeHeaders() string { return p.exposeHeaders }
+func (p *Policy) MaxAge() string        { return p.maxAge }
+
+// Rules holds the current policy and is swapped when the runtime config
+// changes.
+type Rules struct {
+	current atomic.Pointer[Policy]
+}
+
+// NewRules compiles cfg, which must have been validated.
+func NewRules(cfg Config) (*Rules, error) {
+	r := &Rules{}
+	if err := r.Store(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rules) Store(cfg Config) error {
+	p, err := compile(cfg)
+	if err != nil {
+		return err
+	}
+	r.current.Store(p)
+	return nil
+}
+
+func (r *Rules) Policy() *Policy {
+	return r.current.Load()
+}
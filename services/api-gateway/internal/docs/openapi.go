@@ -0,0 +1,189 @@
+// Package docs builds the OpenAPI document the gateway serves, merging the
+// specs generated from the protos of every registered upstream service.
+package docs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+
+	"ms-ride-sharing/shared/authz"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const bearerScheme = "bearer"
+
+// spec is the part of a Swagger 2.0 document the merge needs to understand;
+// operations and schemas are kept as generated.
+type spec struct {
+	Swagger             string                               `json:"swagger"`
+	Info                map[string]any                       `json:"info"`
+	Tags                []map[string]any                     `json:"tags,omitempty"`
+	Consumes            []string                             `json:"consumes,omitempty"`
+	Produces            []string                             `json:"produces,omitempty"`
+	Paths               map[string]map[string]map[string]any `json:"paths"`
+	Definitions         map[string]any                       `json:"definitions"`
+	SecurityDefinitions map[string]any                       `json:"securityDefinitions,omitempty"`
+	Security            []map[string][]string                `json:"security,omitempty"`
+}
+
+// Build merges the specs in specs generated for files, e.g.
+// user/user.swagger.json for user/user.proto. Routes are marked public or
+// protected, with their required roles, from registry, and error responses
+// are described as the problem+json documents the gateway actually returns.
+func Build(specs fs.FS, files []protoreflect.FileDescriptor, registry *authz.Registry) ([]byte, error) {
+	merged := spec{
+		Swagger: "2.0",
+		Info: map[string]any{
+			"title":   "Ride Sharing API",
+			"version": "v1",
+		},
+		Consumes:    []string{"application/json"},
+		Produces:    []string{"application/json"},
+		Paths:       map[string]map[string]map[string]any{},
+		Definitions: map[string]any{},
+		SecurityDefinitions: map[string]any{
+			bearerScheme: map[string]any{
+				"type":        "apiKey",
+				"in":          "header",
+				"name":        "Authorization",
+				"description": "Access token from /api/v1/users/login, sent as `Bearer <token>`.",
+			},
+		},
+		Security: []map[string][]string{{bearerScheme: {}}},
+	}
+
+	tags := map[string]bool{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Path(), ".proto") + ".swagger.json"
+		content, err := fs.ReadFile(specs, name)
+		if err != nil {
+			return nil, fmt.Errorf("openapi spec for %s: %w", file.Path(), err)
+		}
+		var s spec
+		if err := json.Unmarshal(content, &s); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", name, err)
+		}
+
+		for _, tag := range s.Tags {
+			if name, _ := tag["name"].(string); !tags[name] {
+				tags[name] = true
+				merged.Tags = append(merged.Tags, tag)
+			}
+		}
+		for path, operations := range s.Paths {
+			if merged.Paths[path] == nil {
+				merged.Paths[path] = map[string]map[string]any{}
+			}
+			for method, operation := range operations {
+				if _, ok := merged.Paths[path][method]; ok {
+					return nil, fmt.Errorf("%s %s is defined by more than one service", strings.ToUpper(method), path)
+				}
+				if err := secure(operation, method, path, registry); err != nil {
+					return nil, err
+				}
+				useProblemResponses(operation)
+				merged.Paths[path][method] = operation
+			}
+		}
+		// Definitions are named after the last segment of the proto package
+		// and the message, e.g. v1Location, so two services can declare the
+		// same name for different types. Shared types such as protobufAny
+		// come out identical and are merged; anything else is an error.
+		for definitionName, definition := range s.Definitions {
+			if existing, ok := merged.Definitions[definitionName]; ok && !reflect.DeepEqual(existing, definition) {
+				return nil, fmt.Errorf("definition %s in %s conflicts with one from another service", definitionName, name)
+			}
+			merged.Definitions[definitionName] = definition
+		}
+	}
+
+	sort.Slice(merged.Tags, func(i, j int) bool {
+		return fmt.Sprint(merged.Tags[i]["name"]) < fmt.Sprint(merged.Tags[j]["name"])
+	})
+	delete(merged.Definitions, "rpcStatus")
+	merged.Definitions["Problem"] = problemSchema
+
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+// secure overrides the global bearer requirement for public routes and lists
+// the roles allowed on restricted ones.
+func secure(operation map[string]any, method, path string, registry *authz.Registry) error {
+	route, err := authz.NormalizeRoute(strings.ToUpper(method) + ":" + path)
+	if err != nil {
+		return err
+	}
+	rule, ok := registry.Route(route)
+	if !ok {
+		return fmt.Errorf("%s has no auth rule", route)
+	}
+
+	if rule.Public {
+		operation["security"] = []any{}
+		return nil
+	}
+	responses, _ := operation["responses"].(map[string]any)
+	if responses == nil {
+		return nil
+	}
+	responses["401"] = problemResponse("Missing, invalid or expired access token.")
+	if len(rule.Roles) > 0 {
+		operation["x-required-roles"] = rule.Roles
+		responses["403"] = problemResponse("The user's role may not call this route.")
+	}
+	return nil
+}
+
+// useProblemResponses points the generated default response, a gRPC status,
+// at the problem+json document the gateway renders errors as.
+func useProblemResponses(operation map[string]any) {
+	responses, ok := operation["responses"].(map[string]any)
+	if !ok {
+		return
+	}
+	responses["default"] = problemResponse("Error, as RFC 7807 problem details.")
+}
+
+func problemResponse(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"schema":      map[string]any{"$ref": "#/definitions/Problem"},
+	}
+}
+
+// problemSchema mirrors handlers.Problem.
+var problemSchema = map[string]any{
+	"type":     "object",
+	"required": []string{"type", "title", "status", "code"},
+	"properties": map[string]any{
+		"type":     map[string]any{"type": "string"},
+		"title":    map[string]any{"type": "string"},
+		"status":   map[string]any{"type": "integer", "format": "int32"},
+		"detail":   map[string]any{"type": "string"},
+		"instance": map[string]any{"type": "string"},
+		"code": map[string]any{
+			"type":        "string",
+			"description": "Stable machine-readable error code, e.g. TOKEN_INVALID.",
+		},
+		"invalid_params": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name":   map[string]any{"type": "string"},
+					"reason": map[string]any{"type": "string"},
+				},
+			},
+		},
+		"retry_after": map[string]any{"type": "integer", "format": "int32"},
+		"metadata": map[string]any{
+			"type":                 "object",
+			"additionalProperties": map[string]any{"type": "string"},
+		},
+	},
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"mime"
+	"ms-ride-sharing/services/api-gateway/internal/webrpc"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+const CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+
+// RequireJSON answers 415 to requests whose body is not application/json,
+// which grpc-gateway would otherwise try to decode as JSON anyway. Requests
+// without a body pass, and so do gRPC-Web and Connect calls, which webrpc
+// decodes itself.
+func RequireJSON(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		if r.ContentLength == 0 || webrpc.IsRequest(r) {
+			next(w, r, pathParams)
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			WriteProblem(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "request body must be application/json")
+			return
+		}
+		next(w, r, pathParams)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"ms-ride-sharing/services/api-gateway/internal/cors"
+	"net/http"
+)
+
+const CodeCORSRejected = "CORS_REJECTED"
+
+// CORS applies the cross-origin policy. Preflights are answered here and
+// rejected with 403 when the origin, method or headers are not allowed.
+// Actual requests from other origins are still served but get no CORS
+// headers, so the browser keeps the response from the page.
+func CORS(rules *cors.Rules) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := rules.Policy()
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !preflight {
+				if policy.AllowsOrigin(origin) {
+					setAllowOrigin(w, policy, origin)
+					if exposed := policy.ExposeHeaders(); exposed != "" {
+						w.Header().Set("Access-Control-Expose-Headers", exposed)
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch {
+			case !policy.AllowsOrigin(origin):
+				WriteProblem(w, r, http.StatusForbidden, CodeCORSRejected, "origin not allowed")
+				return
+			case !policy.AllowsMethod(r.Header.Get("Access-Control-Request-Method")):
+				WriteProblem(w, r, http.StatusForbidden, CodeCORSRejected, "method not allowed for cross-origin requests")
+				return
+			case !policy.AllowsHeaders(r.Header.Get("Access-Control-Request-Headers")):
+				WriteProblem(w, r, http.StatusForbidden, CodeCORSRejected, "header not allowed for cross-origin requests")
+				return
+			}
+
+			setAllowOrigin(w, policy, origin)
+			w.Header().Set("Access-Control-Allow-Methods", policy.AllowMethods())
+			if headers := policy.AllowHeaders(); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", policy.MaxAge())
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func setAllowOrigin(w http.ResponseWriter, policy *cors.Policy, origin string) {
+	w.Header().Set("Access-Control-Allow-Origin", policy.AllowOrigin(origin))
+	if policy.Credentials() {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
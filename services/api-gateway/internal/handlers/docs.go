@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// swaggerInitializer replaces the one bundled with swagger-ui, which points
+// at the petstore example.
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    persistAuthorization: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// OpenAPI serves the merged OpenAPI document built at startup.
+func OpenAPI(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(spec)
+	}
+}
+
+// Docs serves swagger-ui for /openapi.json under prefix, e.g. /docs/.
+func Docs(prefix string) http.Handler {
+	assets := http.StripPrefix(prefix, http.FileServerFS(swaggerFiles.FS))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix+"swagger-initializer.js" {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Write([]byte(swaggerInitializer))
+			return
+		}
+		assets.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"ms-ride-sharing/shared/health"
+	"ms-ride-sharing/shared/logger"
+	"net/http"
+	"sync/atomic"
+)
+
+type healthResponse struct {
+	Status       string          `json:"status"`
+	Dependencies []health.Status `json:"dependencies,omitempty"`
+}
+
+// Healthz reports that the process is up. It never checks dependencies, so a
+// Redis or upstream outage does not get the gateway restarted.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// Readyz reports whether the gateway should receive traffic: every dependency
+// passed its last check and the server is not draining.
+func Readyz(monitor *health.Monitor, draining *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case draining.Load():
+			writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "draining"})
+		case !monitor.Healthy():
+			writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable"})
+		default:
+			writeJSON(w, http.StatusOK, healthResponse{Status: "ready"})
+		}
+	}
+}
+
+// Status returns the latency and last error of every dependency.
+func Status(monitor *health.Monitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := "ok"
+		if !monitor.Healthy() {
+			status = "degraded"
+		}
+
+		writeJSON(w, http.StatusOK, healthResponse{
+			Status:       status,
+			Dependencies: monitor.Statuses(),
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("error encoding response", logger.Err(err))
+	}
+}
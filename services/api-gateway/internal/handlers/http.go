@@ -1,19 +1,47 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
+	"ms-ride-sharing/services/api-gateway/internal/policy"
+	"ms-ride-sharing/services/api-gateway/internal/session"
+	"ms-ride-sharing/services/api-gateway/internal/upstream"
+	"ms-ride-sharing/shared/authz"
 	"ms-ride-sharing/shared/jwt"
+	"ms-ride-sharing/shared/logger"
+	"ms-ride-sharing/shared/requestid"
 	"net/http"
+	"runtime/debug"
 	"strings"
 	"time"
 
 	jwtLib "github.com/golang-jwt/jwt/v5"
-	"github.com/redis/go-redis/v9"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 )
 
 type Middleware func(http.Handler) http.Handler
 
+type (
+	userIDKey struct{}
+	roleKey   struct{}
+)
+
+// UserIDFromContext returns the ID of the user authenticated by Authenticate.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(string)
+	return userID, ok
+}
+
+// RoleFromContext returns the user type of the user authenticated by
+// Authenticate. Tokens issued before roles were added carry none.
+func RoleFromContext(ctx context.Context) (string, bool) {
+	role, ok := ctx.Value(roleKey{}).(string)
+	return role, ok && role != ""
+}
+
 func Chain(middlewares ...Middleware) Middleware {
 	return func(final http.Handler) http.Handler {
 		for i := len(middlewares) - 1; i >= 0; i-- {
@@ -23,27 +51,15 @@ func Chain(middlewares ...Middleware) Middleware {
 	}
 }
 
-func Logger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		next.ServeHTTP(w, r)
-
-		log.Printf(
-			"%s %s %s",
-			r.Method,
-			r.URL.Path,
-			time.Since(start),
-		)
-	})
-}
-
 func Recoverer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "panic recovered",
+					slog.Any("panic", err),
+					slog.String("stack", string(debug.Stack())),
+				)
+				WriteProblem(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
 			}
 		}()
 
@@ -51,75 +67,222 @@ func Recoverer(next http.Handler) http.Handler {
 	})
 }
 
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// RoutePolicy looks up the policy of the matched route and applies its body
+// size limit and timeout. The timeout becomes the deadline of the upstream
+// gRPC call. Routes in serverStreams, see policy.ServerStreamRoutes, are
+// exempt from the server write timeout.
+func RoutePolicy(table *policy.Table, serverStreams map[string]bool) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			pattern, ok := runtime.HTTPPattern(r.Context())
+			if !ok {
+				next(w, r, pathParams)
+				return
+			}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+			p, ok := table.Lookup(r.Method, pattern.String())
+			if !ok {
+				// Only routes registered outside the proto files end up here.
+				slog.ErrorContext(r.Context(), "no policy for route", slog.String("route", r.Method+":"+pattern.String()))
+				WriteProblem(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			if p.MaxBodyBytes > 0 {
+				if r.ContentLength > p.MaxBodyBytes {
+					WriteProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body too large")
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, p.MaxBodyBytes)
+
+				// A chunked body of unknown length is read up front: past the
+				// limit, grpc-gateway would report a decode error, not 413.
+				if r.ContentLength < 0 {
+					body, err := io.ReadAll(r.Body)
+					var tooLarge *http.MaxBytesError
+					switch {
+					case errors.As(err, &tooLarge):
+						WriteProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body too large")
+						return
+					case err != nil:
+						WriteProblem(w, r, http.StatusBadRequest, CodeBodyUnreadable, "could not read request body")
+						return
+					}
+					r.Body = io.NopCloser(bytes.NewReader(body))
+					r.ContentLength = int64(len(body))
+				}
+			}
+
+			if serverStreams[r.Method+":"+pattern.String()] {
+				http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			}
+
+			ctx := policy.NewContext(r.Context(), p)
+			if p.Timeout > 0 {
+				// Grpc-Timeout and Connect-Timeout-Ms derive from this context,
+				// so clients can only shorten the route timeout.
+				var cancel context.CancelFunc
+				ctx, cancel = upstream.WithTimeout(ctx, p.Timeout)
+				defer cancel()
+			}
+
+			next(w, r.WithContext(ctx), pathParams)
+		}
+	}
 }
 
-func AuthMiddleware(jwtSvc *jwt.JWTService, rdbRepo *redis.Client) Middleware {
-	publicRoutes := map[string]bool{
-		"POST:/api/v1/users":               true, // Login
-		"POST:/api/v1/users/login":         true, // Register user
-		"POST:/api/v1/users/refresh-token": true, // Refresh token
+// IncomingHeaderMatcher is runtime.DefaultHeaderMatcher without the metadata
+// the gateway sets itself: a client sending Grpc-Metadata-X-Internal-Identity
+// or Grpc-Metadata-X-Request-Id could otherwise replay a leaked identity
+// together with the request ID it was minted for.
+func IncomingHeaderMatcher(key string) (string, bool) {
+	name, ok := runtime.DefaultHeaderMatcher(key)
+	if !ok {
+		return "", false
+	}
+	switch strings.ToLower(name) {
+	case authz.IdentityMetadataKey, requestid.MetadataKey:
+		return "", false
 	}
+	return name, true
+}
 
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			routeKey := r.Method + ":" + r.URL.Path
+// RoutePolicies serves the resolved policy of every registered route, for
+// the admin server.
+func RoutePolicies(table *policy.Table) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, table.Routes())
+	}
+}
 
-			if publicRoutes[routeKey] {
-				next.ServeHTTP(w, r)
+// Authenticate enforces the auth rule of the route policy set by
+// RoutePolicy. Requests to public routes pass through untouched; requests
+// without a policy are refused, so a handler mounted outside RoutePolicy
+// cannot become public by accident.
+//
+// Access tokens are only read from the Authorization header. Browsers cannot
+// set headers on WebSocket handshakes, so upgrade requests without one may
+// instead carry a single-use ticket from POST /api/v1/auth/ws-ticket in the
+// ticket query parameter.
+func Authenticate(jwtSvc *jwt.JWTService, sessions *session.Validator) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			p, ok := policy.FromContext(r.Context())
+			if !ok {
+				slog.ErrorContext(r.Context(), "no policy for authenticated request", slog.String("path", r.URL.Path))
+				WriteProblem(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+				return
+			}
+			if p.Public {
+				next(w, r, pathParams)
 				return
 			}
 
-			var tokenStr string
+			var userID, jti, role string
 
-			authHeader := r.Header.Get("Authorization")
-			if authHeader != "" {
-				tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
+			if ticket, ok := websocketTicket(r); ok {
+				t, found, err := sessions.RedeemTicket(r.Context(), ticket)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "error redeeming ws ticket", logger.Err(err))
+					sessionStoreUnavailable(w, r)
+					return
+				}
+				if !found {
+					WriteProblem(w, r, http.StatusUnauthorized, CodeTicketInvalid, "ticket invalid, expired or already used")
+					return
+				}
+				userID, jti, role = t.UserID, t.JTI, t.Role
 			} else {
-				tokenStr = r.URL.Query().Get("token")
-			}
+				tokenStr := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if tokenStr == "" {
+					WriteProblem(w, r, http.StatusUnauthorized, CodeTokenMissing, "token not found")
+					return
+				}
 
-			if tokenStr == "" {
-				http.Error(w, "token not found", http.StatusUnauthorized)
-				return
-			}
+				token, err := jwtSvc.Validate(tokenStr)
+
+				if err != nil || !token.Valid {
+					WriteProblem(w, r, http.StatusUnauthorized, CodeTokenInvalid, "token invalid or expired")
+					return
+				}
 
-			token, err := jwtSvc.Validate(tokenStr)
+				claims, ok := token.Claims.(jwtLib.MapClaims)
+				if !ok {
+					WriteProblem(w, r, http.StatusUnauthorized, CodeTokenInvalid, "invalid claims")
+					return
+				}
 
-			if err != nil || !token.Valid {
-				http.Error(w, "token invalid or expired", http.StatusUnauthorized)
+				userID, _ = claims["sub"].(string)
+				jti, _ = claims["jti"].(string)
+				role, _ = claims["role"].(string)
+			}
+			if userID == "" || jti == "" {
+				WriteProblem(w, r, http.StatusUnauthorized, CodeTokenInvalid, "invalid claims")
 				return
 			}
 
-			claims, ok := token.Claims.(jwtLib.MapClaims)
-			if !ok {
-				http.Error(w, "invalid claims", http.StatusUnauthorized)
+			active, err := sessions.Valid(r.Context(), userID, jti)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "error validating session", logger.Err(err))
+				sessionStoreUnavailable(w, r)
+				return
+			}
+			if !active {
+				WriteProblem(w, r, http.StatusUnauthorized, CodeSessionExpired, "session expired")
 				return
 			}
 
-			userID := claims["sub"].(string)
-			jti := claims["jti"].(string)
+			ctx := context.WithValue(r.Context(), userIDKey{}, userID)
+			ctx = context.WithValue(ctx, roleKey{}, role)
+			ctx = logger.WithAttrs(ctx, slog.String("user_id", userID))
 
-			activeJti, err := rdbRepo.Get(r.Context(), "session:"+userID).Result()
-			if err != nil || activeJti != jti {
-				http.Error(w, "session expired", http.StatusUnauthorized)
+			if !p.Allows(role) {
+				WriteProblem(w, r, http.StatusForbidden, CodeRoleNotAllowed, "route not allowed for this user type")
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), "user_id", userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+			next(w, r.WithContext(ctx), pathParams)
+		}
+	}
+}
+
+// websocketTicket returns the ticket of a WebSocket upgrade request that has
+// no Authorization header, removing it from the query so it is not passed
+// on. Tickets anywhere else are ignored.
+func websocketTicket(r *http.Request) (string, bool) {
+	if r.Header.Get("Authorization") != "" || !IsWebSocketUpgrade(r) {
+		return "", false
+	}
+	query := r.URL.Query()
+	ticket := query.Get("ticket")
+	if ticket == "" {
+		return "", false
 	}
+	query.Del("ticket")
+	r.URL.RawQuery = query.Encode()
+	return ticket, true
+}
+
+// IsWebSocketUpgrade reports whether r is a WebSocket opening handshake.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sessionStoreUnavailable(w http.ResponseWriter, r *http.Request) {
+	problem := NewProblem(http.StatusServiceUnavailable, CodeSessionStoreUnavailable, "session store unavailable")
+	retryAfter := 1
+	problem.RetryAfter = &retryAfter
+	problem.Write(w, r)
 }
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"ms-ride-sharing/services/api-gateway/internal/idempotency"
+	"ms-ride-sharing/services/api-gateway/internal/policy"
+	"ms-ride-sharing/shared/logger"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+const (
+	CodeIdempotencyKeyInvalid = "IDEMPOTENCY_KEY_INVALID"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	CodeIdempotencyStoreDown  = "IDEMPOTENCY_STORE_UNAVAILABLE"
+	CodeBodyUnreadable        = "BODY_UNREADABLE"
+)
+
+// replayedHeaders are the response headers kept with a stored response.
+// Everything else (request ID, rate limit headers) belongs to the retry.
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// Idempotency makes POST and PATCH requests carrying an Idempotency-Key safe
+// to retry: the first response is stored and replayed to retries with the
+// same key and body. A retry with a different body gets 409 and one arriving
+// while the first is still running gets 425. Keys are scoped per user (or per
+// client IP for anonymous callers) and per route. Only final outcomes are
+// stored: after a server error, a timeout, a rate limit or a canceled request
+// the key is released, so the retry gets its own result. Sensitive routes
+// ignore the header: their responses carry tokens that must not sit in Redis.
+func Idempotency(store *idempotency.Store, trustProxy bool) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next(w, r, pathParams)
+				return
+			}
+			if p, ok := policy.FromContext(r.Context()); ok && p.Sensitive {
+				next(w, r, pathParams)
+				return
+			}
+			if !validIdempotencyKey(key) {
+				WriteProblem(w, r, http.StatusBadRequest, CodeIdempotencyKeyInvalid, "Idempotency-Key must be 1 to 255 visible ASCII characters")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					WriteProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body too large")
+					return
+				}
+				WriteProblem(w, r, http.StatusBadRequest, CodeBodyUnreadable, "could not read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := idempotencyScope(r, trustProxy) + ":" + key
+			fingerprint := requestFingerprint(r, body)
+
+			existing, err := store.Begin(r.Context(), storeKey, fingerprint)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "error claiming idempotency key", logger.Err(err))
+				problem := NewProblem(http.StatusServiceUnavailable, CodeIdempotencyStoreDown, "idempotency store unavailable")
+				retryAfter := 1
+				problem.RetryAfter = &retryAfter
+				problem.Write(w, r)
+				return
+			}
+
+			switch {
+			case existing == nil:
+				idempotency.Observe(idempotency.ResultClaimed)
+			case existing.Fingerprint != fingerprint:
+				idempotency.Observe(idempotency.ResultMismatch)
+				WriteProblem(w, r, http.StatusConflict, CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request")
+				return
+			case !existing.Done:
+				idempotency.Observe(idempotency.ResultInProgress)
+				problem := NewProblem(http.StatusTooEarly, CodeIdempotencyInProgress, "a request with this Idempotency-Key is still in progress")
+				retryAfter := 1
+				problem.RetryAfter = &retryAfter
+				problem.Write(w, r)
+				return
+			default:
+				idempotency.Observe(idempotency.ResultReplayed)
+				replay(w, existing)
+				return
+			}
+
+			capture := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+			next(capture, r, pathParams)
+
+			// The client may be gone by now; the outcome must still be saved.
+			ctx := context.WithoutCancel(r.Context())
+			if !finalOutcome(capture.status) || r.Context().Err() != nil {
+				if err := store.Release(ctx, storeKey); err != nil {
+					slog.ErrorContext(ctx, "error releasing idempotency key", logger.Err(err))
+				}
+				return
+			}
+
+			rec := idempotency.Record{
+				Fingerprint: fingerprint,
+				Status:      capture.status,
+				Header:      http.Header{},
+				Body:        capture.body.Bytes(),
+			}
+			for _, name := range replayedHeaders {
+				if value := w.Header().Get(name); value != "" {
+					rec.Header.Set(name, value)
+				}
+			}
+			if err := store.Complete(ctx, storeKey, rec); err != nil {
+				slog.ErrorContext(ctx, "error storing idempotent response", logger.Err(err))
+			}
+		}
+	}
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// finalOutcome reports whether a response with status is the result of the
+// request, rather than a failure to get one that a retry may get past.
+func finalOutcome(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, statusClientClosedRequest:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+func idempotencyScope(r *http.Request, trustProxy bool) string {
+	// Anonymous callers must not see each other's keys, or one could replay
+	// the stored response of another.
+	owner := "ip:" + clientIP(r, trustProxy)
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		owner = "user:" + userID
+	}
+	template := r.URL.Path
+	if pattern, ok := runtime.HTTPPattern(r.Context()); ok {
+		template = pattern.String()
+	}
+	return owner + ":" + r.Method + ":" + template
+}
+
+// requestFingerprint covers what makes two requests the same operation: the
+// concrete path (with its parameters), the query and the body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, rec *idempotency.Record) {
+	for name, values := range rec.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// captureWriter passes the response through while keeping a copy of it.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	c.status = status
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
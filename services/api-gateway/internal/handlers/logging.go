@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"ms-ride-sharing/shared/logger"
+	"ms-ride-sharing/shared/requestid"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace when
+// the client sent a W3C traceparent header. The span is renamed to the route
+// template once grpc-gateway matches the request.
+func Tracing(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// RequestID reuses a well-formed X-Request-ID sent by the client or creates
+// one, stores it in the request context and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		w.Header().Set(requestid.Header, id)
+		ctx := requestid.NewContext(r.Context(), id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type routeKey struct{}
+
+// route is filled in by RouteTemplate once grpc-gateway has matched the
+// request, so middleware running outside the mux can report it.
+type route struct {
+	template string
+}
+
+// withRoute returns the route holder of r, adding one to its context when
+// no outer middleware did yet.
+func withRoute(r *http.Request) (*route, *http.Request) {
+	if rt, ok := r.Context().Value(routeKey{}).(*route); ok {
+		return rt, r
+	}
+	rt := &route{}
+	return rt, r.WithContext(context.WithValue(r.Context(), routeKey{}, rt))
+}
+
+func (rt *route) String() string {
+	if rt.template == "" {
+		return "unmatched"
+	}
+	return rt.template
+}
+
+// RouteTemplate is a grpc-gateway middleware that records the matched path
+// template (e.g. /api/v1/users/login) for the access log and the trace span.
+func RouteTemplate(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		if pattern, ok := runtime.HTTPPattern(r.Context()); ok {
+			template := pattern.String()
+			if rt, ok := r.Context().Value(routeKey{}).(*route); ok {
+				rt.template = template
+			}
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + template)
+			span.SetAttributes(semconv.HTTPRoute(template))
+		}
+		next(w, r, pathParams)
+	}
+}
+
+// Logger writes one access log line per request with status, response size,
+// latency, route template and, when authenticated, the user ID.
+func Logger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rt, r := withRoute(r)
+		ctx := logger.WithAttrs(r.Context())
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+
+		slog.Log(ctx, level, "http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", rt.String()),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush and Hijack on the
+// underlying writer, which streaming responses rely on.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack hands the connection over for WebSocket upgrades, which libraries
+// detect with a type assertion rather than through Unwrap.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+func (r *responseRecorder) Flush() {
+	r.wroteHeader = true
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
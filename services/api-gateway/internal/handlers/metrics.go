@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"ms-ride-sharing/shared/metrics"
+	"net/http"
+	"time"
+)
+
+// Metrics records request rate, errors and duration per route template.
+// Requests that match no route are grouped under "unmatched". WebSocket
+// connections are left to the proxy, which reports them on its own.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		done := metrics.TrackInFlight()
+		defer done()
+
+		rt, r := withRoute(r)
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		metrics.ObserveHTTP(r.Method, rt.String(), rec.status, start)
+	})
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"ms-ride-sharing/services/api-gateway/internal/upstream"
+	"ms-ride-sharing/services/api-gateway/internal/webrpc"
+	"ms-ride-sharing/shared/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// statusClientClosedRequest is what grpc-gateway answers for codes.Canceled.
+const statusClientClosedRequest = 499
+
+// Stable codes for errors raised by the gateway itself.
+const (
+	CodeTokenMissing            = "TOKEN_MISSING"
+	CodeTokenInvalid            = "TOKEN_INVALID"
+	CodeSessionExpired          = "SESSION_EXPIRED"
+	CodeTicketInvalid           = "TICKET_INVALID"
+	CodeSessionStoreUnavailable = "SESSION_STORE_UNAVAILABLE"
+	CodeRoleNotAllowed          = "ROLE_NOT_ALLOWED"
+	CodeBodyTooLarge            = "BODY_TOO_LARGE"
+	CodeInternal                = "INTERNAL"
+)
+
+// grpcCodeNames are the fallback codes used when an upstream error carries
+// no ErrorInfo reason.
+var grpcCodeNames = map[codes.Code]string{
+	codes.Canceled:           "CANCELED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// Problem is an RFC 7807 problem details document. Code is a stable
+// machine-readable identifier clients should branch on instead of Detail.
+type Problem struct {
+	Type          string            `json:"type"`
+	Title         string            `json:"title"`
+	Status        int               `json:"status"`
+	Detail        string            `json:"detail,omitempty"`
+	Instance      string            `json:"instance,omitempty"`
+	Code          string            `json:"code"`
+	InvalidParams []InvalidParam    `json:"invalid_params,omitempty"`
+	RetryAfter    *int              `json:"retry_after,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func NewProblem(statusCode int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WriteProblem renders a gateway-originated error as problem+json.
+func WriteProblem(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	NewProblem(statusCode, code, detail).Write(w, r)
+}
+
+// Write renders p as problem+json or, for gRPC-Web and Connect calls, as an
+// error of their protocol with the same code in its ErrorInfo.
+func (p *Problem) Write(w http.ResponseWriter, r *http.Request) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RetryAfter != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(*p.RetryAfter))
+	}
+	if webrpc.IsRequest(r) {
+		webrpc.WriteError(w, r, p.grpcStatus())
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.Error("error encoding problem response", logger.Err(err))
+	}
+}
+
+// ProblemFromStatus converts a gRPC status, including its ErrorInfo,
+// BadRequest and RetryInfo details, into a Problem.
+func ProblemFromStatus(st *status.Status) *Problem {
+	statusCode := runtime.HTTPStatusFromCode(st.Code())
+
+	code, ok := grpcCodeNames[st.Code()]
+	if !ok {
+		code = grpcCodeNames[codes.Unknown]
+	}
+
+	problem := NewProblem(statusCode, code, st.Message())
+	if st.Code() == codes.Internal || st.Code() == codes.Unknown {
+		// Never leak upstream internals to clients.
+		problem.Detail = http.StatusText(statusCode)
+	}
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if d.GetReason() != "" {
+				problem.Code = d.GetReason()
+			}
+			if len(d.GetMetadata()) > 0 {
+				problem.Metadata = d.GetMetadata()
+			}
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				problem.InvalidParams = append(problem.InvalidParams, InvalidParam{
+					Name:   v.GetField(),
+					Reason: v.GetDescription(),
+				})
+			}
+		case *errdetails.RetryInfo:
+			seconds := int(math.Ceil(d.GetRetryDelay().AsDuration().Seconds()))
+			problem.RetryAfter = &seconds
+		}
+	}
+
+	return problem
+}
+
+// grpcCodes map the statuses of gateway-originated errors back to gRPC codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusMethodNotAllowed:      codes.Unimplemented,
+	http.StatusConflict:              codes.Aborted,
+	http.StatusPreconditionFailed:    codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	statusClientClosedRequest:        codes.Canceled,
+	http.StatusInternalServerError:   codes.Internal,
+	http.StatusNotImplemented:        codes.Unimplemented,
+	http.StatusBadGateway:            codes.Unavailable,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+// grpcStatus is the inverse of ProblemFromStatus, for clients that expect
+// gRPC errors.
+func (p *Problem) grpcStatus() *status.Status {
+	code, ok := grpcCodes[p.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason:   p.Code,
+		Domain:   upstream.ErrorDomain,
+		Metadata: p.Metadata,
+	}}
+	if len(p.InvalidParams) > 0 {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(p.InvalidParams))
+		for i, param := range p.InvalidParams {
+			violations[i] = &errdetails.BadRequest_FieldViolation{Field: param.Name, Description: param.Reason}
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+	if p.RetryAfter != nil {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(*p.RetryAfter) * time.Second)})
+	}
+
+	st := status.New(code, p.Detail)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st
+}
+
+// ProblemErrorHandler is a grpc-gateway error handler that renders every
+// upstream and routing error as problem+json.
+func ProblemErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	ProblemFromStatus(status.Convert(err)).Write(w, r)
+}
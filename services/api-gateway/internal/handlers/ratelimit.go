@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"log/slog"
+	"math"
+	"ms-ride-sharing/services/api-gateway/internal/policy"
+	"ms-ride-sharing/services/api-gateway/internal/ratelimit"
+	"ms-ride-sharing/shared/logger"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+const CodeRateLimited = "RATE_LIMITED"
+
+// RateLimit applies the rate limit class of the route policy. It runs after
+// Authenticate, so authenticated requests are limited by user ID and
+// anonymous ones by client IP. When trustProxy is set, the client IP is taken
+// from the last X-Forwarded-For entry, added by the load balancer.
+func RateLimit(limiter ratelimit.Limiter, rules *ratelimit.Rules, trustProxy bool) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			p, ok := policy.FromContext(r.Context())
+			if !ok || p.RateLimit == "" {
+				next(w, r, pathParams)
+				return
+			}
+
+			key := "ip:" + clientIP(r, trustProxy)
+			if userID, ok := UserIDFromContext(r.Context()); ok {
+				key = "user:" + userID
+			}
+			if allow(w, r, limiter, rules, p.RateLimit, key) {
+				next(w, r, pathParams)
+			}
+		}
+	}
+}
+
+// RateLimitClientIP applies class to every request by client IP. It runs
+// before Authenticate, so requests with a missing or forged token, or a
+// guessed WebSocket ticket, are throttled before they cost a signature check
+// or a Redis lookup. Without the class in the runtime config it does nothing.
+func RateLimitClientIP(limiter ratelimit.Limiter, rules *ratelimit.Rules, class string, trustProxy bool) runtime.Middleware {
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			if allow(w, r, limiter, rules, class, "ip:"+clientIP(r, trustProxy)) {
+				next(w, r, pathParams)
+			}
+		}
+	}
+}
+
+// allow consumes one request of class for key. When the limit is exceeded it
+// answers 429 and returns false; unknown classes always allow.
+func allow(w http.ResponseWriter, r *http.Request, limiter ratelimit.Limiter, rules *ratelimit.Rules, class, key string) bool {
+	limit, ok := rules.Lookup(class)
+	if !ok {
+		return true
+	}
+
+	res, err := limiter.Allow(r.Context(), class+":"+key, limit)
+	if err != nil {
+		// Only reached when the request itself was canceled.
+		slog.WarnContext(r.Context(), "rate limit check failed", logger.Err(err))
+		return true
+	}
+
+	w.Header().Set("RateLimit-Policy", limit.Policy())
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+	if !res.Allowed {
+		// Set by RouteTemplate and by the WebSocket handler.
+		if rt, ok := r.Context().Value(routeKey{}).(*route); ok && rt.template != "" {
+			ratelimit.ObserveRejected(rt.template)
+		}
+
+		problem := NewProblem(http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded")
+		retryAfter := ceilSeconds(res.RetryAfter)
+		problem.RetryAfter = &retryAfter
+		problem.Write(w, r)
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		// A client may send its own X-Forwarded-For line and the load
+		// balancer append another, so the lines are joined before taking
+		// the last hop.
+		if forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ","); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
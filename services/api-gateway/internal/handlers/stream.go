@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"ms-ride-sharing/services/api-gateway/internal/cors"
+	"ms-ride-sharing/services/api-gateway/internal/realtime"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/status"
+)
+
+type bridgeKey struct{}
+
+// StreamBridge lets WebSocket handshakes reach the streaming RPCs on gwmux.
+// A handshake is a GET, so it is forwarded as the POST the RPC is mapped to
+// and StreamWebSocket takes over once the route matched and the request was
+// authenticated. It must come after CORS, right before gwmux.
+func StreamBridge(corsRules *cors.Rules) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || !IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if origin := r.Header.Get("Origin"); origin != "" && !corsRules.Policy().AllowsOrigin(origin) {
+				WriteProblem(w, r, http.StatusForbidden, CodeOriginNotAllowed, "origin not allowed")
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), bridgeKey{}, true))
+			r.Method = http.MethodPost
+			// Keys cover a single request; a stream carries many.
+			r.Header.Del(IdempotencyKeyHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// StreamWebSocket serves handshakes forwarded by StreamBridge on the routes
+// in streams, the client and bidirectional streaming RPCs, over the proxy.
+// Other routes answer 400. Messages reach the upstream with the same
+// metadata as any gateway call, including the signed internal identity.
+func StreamWebSocket(proxy *realtime.Proxy, streams map[string]bool, trustProxy bool) runtime.Middleware {
+	errorCode := func(st *status.Status) (int, string) {
+		problem := ProblemFromStatus(st)
+		return problem.Status, problem.Code
+	}
+
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			if bridged, _ := r.Context().Value(bridgeKey{}).(bool); !bridged {
+				next(w, r, pathParams)
+				return
+			}
+
+			pattern, ok := runtime.HTTPPattern(r.Context())
+			route := r.Method + ":" + pattern.String()
+			if !ok || !streams[route] {
+				WriteProblem(w, r, http.StatusBadRequest, CodeNotWebSocketRoute, "this route does not accept websocket connections")
+				return
+			}
+
+			release, ok := acquireConnection(w, r, proxy, clientIP(r, trustProxy))
+			if !ok {
+				return
+			}
+			defer release()
+
+			proxy.Bridge(w, r, route, func(w http.ResponseWriter, r *http.Request) {
+				next(w, r, pathParams)
+			}, errorCode)
+		}
+	}
+}
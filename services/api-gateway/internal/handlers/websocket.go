@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"ms-ride-sharing/services/api-gateway/internal/cors"
+	"ms-ride-sharing/services/api-gateway/internal/policy"
+	"ms-ride-sharing/services/api-gateway/internal/realtime"
+	"ms-ride-sharing/shared/authz"
+	"ms-ride-sharing/shared/logger"
+	"ms-ride-sharing/shared/requestid"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	CodeUpgradeRequired     = "WEBSOCKET_UPGRADE_REQUIRED"
+	CodeOriginNotAllowed    = "ORIGIN_NOT_ALLOWED"
+	CodeConnectionLimit     = "WEBSOCKET_LIMIT_REACHED"
+	CodeShuttingDown        = "SHUTTING_DOWN"
+	CodeUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+	CodeNotWebSocketRoute   = "WEBSOCKET_NOT_SUPPORTED"
+)
+
+// WebSocket relays connections opened on target.Path to its backend. The
+// handshake goes through guard, the client IP limit, Authenticate and
+// RateLimit, with the route's auth rule and rate limit class, so it takes an
+// access token or a WebSocket ticket, and browsers may only connect from
+// origins the CORS policy allows. The backend receives the request ID
+// and, for authenticated users, the signed internal identity as headers.
+func WebSocket(
+	target realtime.Route,
+	proxy *realtime.Proxy,
+	guard runtime.Middleware,
+	corsRules *cors.Rules,
+	identities *authz.Signer,
+	trustProxy bool,
+) http.Handler {
+	relay := guard(func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx := r.Context()
+		ip := clientIP(r, trustProxy)
+
+		release, ok := acquireConnection(w, r, proxy, ip)
+		if !ok {
+			return
+		}
+		defer release()
+		userID, authenticated := UserIDFromContext(ctx)
+
+		header := http.Header{}
+		requestID := requestid.FromContext(ctx)
+		header.Set(requestid.Header, requestID)
+		header.Set("X-Forwarded-For", ip)
+		if authenticated {
+			role, _ := RoleFromContext(ctx)
+			token, err := identities.Sign(authz.Identity{UserID: userID, Role: role}, requestID)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to sign internal identity", logger.Err(err))
+				WriteProblem(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+				return
+			}
+			header.Set(authz.IdentityMetadataKey, token)
+		}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+
+		backend, err := proxy.Dial(ctx, target, header, websocket.Subprotocols(r))
+		if err != nil {
+			slog.ErrorContext(ctx, "error dialing websocket backend", slog.String("backend", target.Backend), logger.Err(err))
+			WriteProblem(w, r, http.StatusBadGateway, CodeUpstreamUnavailable, "websocket backend unavailable")
+			return
+		}
+		proxy.Relay(w, r, target.Path, backend)
+	})
+
+	rule := policy.Policy{Public: target.Public, Roles: target.Roles, RateLimit: target.RateLimit}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rt, ok := r.Context().Value(routeKey{}).(*route); ok {
+			rt.template = target.Path
+		}
+
+		if !IsWebSocketUpgrade(r) {
+			w.Header().Set("Upgrade", "websocket")
+			WriteProblem(w, r, http.StatusUpgradeRequired, CodeUpgradeRequired, "this route only accepts websocket connections")
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && !corsRules.Policy().AllowsOrigin(origin) {
+			WriteProblem(w, r, http.StatusForbidden, CodeOriginNotAllowed, "origin not allowed")
+			return
+		}
+
+		relay(w, r.WithContext(policy.NewContext(r.Context(), rule)), nil)
+	})
+}
+
+// acquireConnection reserves a connection slot for the authenticated user or,
+// on public routes, for the client IP. When none is available it answers the
+// request and returns false.
+func acquireConnection(w http.ResponseWriter, r *http.Request, proxy *realtime.Proxy, ip string) (release func(), ok bool) {
+	owner := "ip:" + ip
+	if userID, authenticated := UserIDFromContext(r.Context()); authenticated {
+		owner = "user:" + userID
+	}
+
+	release, err := proxy.Acquire(owner)
+	switch {
+	case errors.Is(err, realtime.ErrDraining):
+		problem := NewProblem(http.StatusServiceUnavailable, CodeShuttingDown, "gateway is shutting down")
+		retryAfter := 1
+		problem.RetryAfter = &retryAfter
+		problem.Write(w, r)
+		return nil, false
+	case errors.Is(err, realtime.ErrTooManyConnections):
+		WriteProblem(w, r, http.StatusTooManyRequests, CodeConnectionLimit, "too many open websocket connections")
+		return nil, false
+	}
+	return release, true
+}
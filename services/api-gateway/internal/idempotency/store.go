@@ -0,0 +1,108 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "idempotency:"
+
+// Outcomes of a request carrying an Idempotency-Key, for Observe.
+const (
+	ResultClaimed    = "claimed"
+	ResultReplayed   = "replayed"
+	ResultInProgress = "in_progress"
+	ResultMismatch   = "mismatch"
+)
+
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_idempotency_requests_total",
+	Help: "Requests carrying an Idempotency-Key, by outcome.",
+}, []string{"result"})
+
+func Observe(result string) {
+	requests.WithLabelValues(result).Inc()
+}
+
+// Record is what is kept per key: the fingerprint of the first request and,
+// once it finished, its response.
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Store keeps idempotency records in Redis. Responses are kept for ttl; a
+// request in progress holds its key for lockTTL, which must outlast the
+// longest route timeout so a slow request is not run twice.
+type Store struct {
+	rdb     redis.Cmdable
+	ttl     time.Duration
+	lockTTL time.Duration
+}
+
+func NewStore(rdb redis.Cmdable, ttl, lockTTL time.Duration) *Store {
+	return &Store{rdb: rdb, ttl: ttl, lockTTL: lockTTL}
+}
+
+// Begin claims key for a request with fingerprint. It returns nil when the
+// caller got the key and must run the request, or the record left by an
+// earlier request with the same key.
+func (s *Store) Begin(ctx context.Context, key, fingerprint string) (*Record, error) {
+	claim, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	// The earlier record may expire between SET NX and GET; try once more.
+	for range 2 {
+		ok, err := s.rdb.SetNX(ctx, keyPrefix+key, claim, s.lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+
+		content, err := s.rdb.Get(ctx, keyPrefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var existing Record
+		if err := json.Unmarshal(content, &existing); err != nil {
+			return nil, fmt.Errorf("decoding idempotency record: %w", err)
+		}
+		return &existing, nil
+	}
+	return nil, errors.New("idempotency key kept changing while claiming it")
+}
+
+// Complete stores the response of a claimed request.
+func (s *Store) Complete(ctx context.Context, key string, rec Record) error {
+	rec.Done = true
+	content, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, keyPrefix+key, content, s.ttl).Err()
+}
+
+// Release frees a claimed key so the request can be retried, e.g. after an
+// upstream failure.
+func (s *Store) Release(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, keyPrefix+key).Err()
+}
@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ms-ride-sharing/shared/authz"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy describes how the gateway treats one route. Public and Roles come
+// from the (ridesharing.auth) option of the RPC behind the route; the rest is
+// configured, with the fields a route does not set inherited from the
+// default policy.
+type Policy struct {
+	Public bool     `yaml:"-"`
+	Roles  []string `yaml:"-"`
+	// RateLimit names a class from rate_limits. Routes sharing a class share
+	// the same budget; empty means unlimited.
+	RateLimit    string        `yaml:"rate_limit"`
+	MaxBodyBytes int64         `yaml:"max_body_bytes"`
+	Timeout      time.Duration `yaml:"timeout"`
+	// Sensitive routes return credentials, such as tokens, so their
+	// responses are never stored for Idempotency-Key replays.
+	Sensitive bool `yaml:"sensitive"`
+
+	// set holds the keys given in the YAML, so a route can set a field to
+	// its zero value, e.g. timeout: 0 or sensitive: false, instead of
+	// inheriting it. Policies built in Go only set their non-zero fields.
+	set map[string]bool
+}
+
+// UnmarshalYAML records which keys the policy sets.
+func (p *Policy) UnmarshalYAML(node *yaml.Node) error {
+	type plain Policy
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	p.set = map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		p.set[node.Content[i].Value] = true
+	}
+	return nil
+}
+
+// MarshalJSON renders Timeout as a duration string in the effective config.
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"public":         p.Public,
+		"roles":          p.Roles,
+		"rate_limit":     p.RateLimit,
+		"max_body_bytes": p.MaxBodyBytes,
+		"timeout":        p.Timeout.String(),
+		"sensitive":      p.Sensitive,
+	})
+}
+
+// inherit fills the fields p does not set from defaults.
+func (p Policy) inherit(defaults Policy) Policy {
+	if p.RateLimit == "" && !p.set["rate_limit"] {
+		p.RateLimit = defaults.RateLimit
+	}
+	if p.MaxBodyBytes == 0 && !p.set["max_body_bytes"] {
+		p.MaxBodyBytes = defaults.MaxBodyBytes
+	}
+	if p.Timeout == 0 && !p.set["timeout"] {
+		p.Timeout = defaults.Timeout
+	}
+	if !p.Sensitive && !p.set["sensitive"] {
+		p.Sensitive = defaults.Sensitive
+	}
+	return p
+}
+
+// Allows reports whether a user with role may call the route.
+func (p Policy) Allows(role string) bool {
+	return len(p.Roles) == 0 || slices.Contains(p.Roles, role)
+}
+
+// Validate checks p on its own; rateLimits reports whether a rate limit
+// class exists.
+func (p Policy) Validate(rateLimits func(class string) bool) error {
+	if p.RateLimit != "" && !rateLimits(p.RateLimit) {
+		return fmt.Errorf("unknown rate_limit class %q", p.RateLimit)
+	}
+	if p.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes must not be negative, got %d", p.MaxBodyBytes)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", p.Timeout)
+	}
+	return nil
+}
+
+// ServerStreamRoutes lists, in METHOD:/template form, the routes of the RPCs
+// in files that stream their response. They outlive the HTTP server write
+// timeout and are bounded by their route timeout instead.
+func ServerStreamRoutes(files ...protoreflect.FileDescriptor) map[string]bool {
+	routes := map[string]bool{}
+	for _, file := range files {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				if !method.IsStreamingServer() {
+					continue
+				}
+				for _, route := range authz.HTTPRoutes(method) {
+					routes[route] = true
+				}
+			}
+		}
+	}
+	return routes
+}
+
+// Table resolves the policy of every route registered on the gateway. It is
+// swapped atomically when the runtime config changes.
+type Table struct {
+	registry *authz.Registry
+	current  atomic.Pointer[map[string]Policy]
+}
+
+// NewTable creates an empty table for the routes of registry, which must be
+// built from the same proto files registered on the gateway mux. Store must
+// be called before Lookup.
+func NewTable(registry *authz.Registry) *Table {
+	return &Table{registry: registry}
+}
+
+// Store resolves the policy of every registered route. It fails when a
+// configured route is not registered on the gateway, so a typo cannot
+// silently leave a route with the default policy.
+func (t *Table) Store(defaults Policy, configured map[string]Policy) error {
+	routes := t.registry.Routes()
+	resolved := make(map[string]Policy, len(routes))
+	for _, route := range routes {
+		resolved[route] = defaults
+	}
+
+	var unknown []string
+	for key, p := range configured {
+		route, err := authz.NormalizeRoute(key)
+		if err != nil {
+			return err
+		}
+		if _, ok := resolved[route]; !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		resolved[route] = p.inherit(defaults)
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("routes not registered on the gateway: %s", strings.Join(unknown, ", "))
+	}
+
+	for route, p := range resolved {
+		rule, _ := t.registry.Route(route)
+		p.Public, p.Roles = rule.Public, rule.Roles
+		resolved[route] = p
+	}
+
+	// gRPC-Web and Connect clients call RPCs on their gRPC path, which
+	// follows the policy of the primary HTTP route so both paths share the
+	// same limits.
+	for _, method := range t.registry.Methods() {
+		p := defaults
+		if route, ok := t.registry.PrimaryRoute(method); ok {
+			p = resolved[route]
+		} else {
+			rule, _ := t.registry.Method(method)
+			p.Public, p.Roles = rule.Public, rule.Roles
+		}
+		resolved[http.MethodPost+":"+method] = p
+	}
+
+	t.current.Store(&resolved)
+	return nil
+}
+
+// Lookup returns the policy of a matched route; template is the grpc-gateway
+// pattern string, e.g. /api/v1/rides/{id=*}.
+func (t *Table) Lookup(method, template string) (Policy, bool) {
+	current := t.current.Load()
+	if current == nil {
+		return Policy{}, false
+	}
+	p, ok := (*current)[method+":"+template]
+	return p, ok
+}
+
+// Routes returns the resolved policy of every registered route.
+func (t *Table) Routes() map[string]Policy {
+	current := t.current.Load()
+	if current == nil {
+		return nil
+	}
+	return *current
+}
+
+type policyKey struct{}
+
+func NewContext(ctx context.Context, p Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, p)
+}
+
+func FromContext(ctx context.Context) (Policy, bool) {
+	p, ok := ctx.Value(policyKey{}).(Policy)
+	return p, ok
+}
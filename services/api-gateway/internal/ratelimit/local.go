@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"ms-ride-sharing/shared/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LocalLimiter runs the same algorithm as RedisLimiter in memory. Limits are
+// per replica, so with N gateways a client may get up to N times the limit.
+type LocalLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{tats: make(map[string]time.Time)}
+}
+
+func (l *LocalLimiter) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	emission := limit.emissionInterval()
+	burstOffset := emission * time.Duration(limit.burst())
+
+	tat, ok := l.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(emission)
+	diff := now.Sub(newTAT.Add(-burstOffset))
+	if diff < 0 {
+		return Result{
+			Limit:      limit.burst(),
+			RetryAfter: -diff,
+			ResetAfter: tat.Sub(now),
+		}, nil
+	}
+
+	l.tats[key] = newTAT
+	return Result{
+		Allowed:    true,
+		Limit:      limit.burst(),
+		Remaining:  int(diff / emission),
+		ResetAfter: newTAT.Sub(now),
+	}, nil
+}
+
+// sweep drops keys whose TAT has passed, at most once a minute, since those
+// behave exactly like keys that were never seen.
+func (l *LocalLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, tat := range l.tats {
+		if tat.Before(now) {
+			delete(l.tats, key)
+		}
+	}
+}
+
+// FallbackLimiter uses primary and switches to fallback when primary fails.
+// After a failure, primary is left alone for cooldown so that an outage does
+// not add a timeout to every request.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	timeout  time.Duration
+	cooldown time.Duration
+
+	retryAt  atomic.Int64
+	degraded atomic.Bool
+}
+
+func NewFallbackLimiter(primary, fallback Limiter, timeout, cooldown time.Duration) *FallbackLimiter {
+	return &FallbackLimiter{
+		primary:  primary,
+		fallback: fallback,
+		timeout:  timeout,
+		cooldown: cooldown,
+	}
+}
+
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if time.Now().UnixNano() >= l.retryAt.Load() {
+		primaryCtx, cancel := context.WithTimeout(ctx, l.timeout)
+		res, err := l.primary.Allow(primaryCtx, key, limit)
+		cancel()
+		if err == nil {
+			if l.degraded.CompareAndSwap(true, false) {
+				slog.InfoContext(ctx, "rate limiter recovered, using redis again")
+			}
+			return res, nil
+		}
+
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+
+		l.retryAt.Store(time.Now().Add(l.cooldown).UnixNano())
+		if l.degraded.CompareAndSwap(false, true) {
+			slog.WarnContext(ctx, "rate limiter falling back to in-process limits", logger.Err(err))
+		}
+	}
+
+	fallbackChecks.Inc()
+	return l.fallback.Allow(ctx, key, limit)
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Limit allows Rate requests per Period, sustained, with up to Burst of them
+// sent back to back. Burst defaults to Rate.
+type Limit struct {
+	Rate   int           `yaml:"rate"`
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"`
+}
+
+// MarshalJSON renders Period as a duration string in the effective config.
+func (l Limit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"rate":   l.Rate,
+		"period": l.Period.String(),
+		"burst":  l.burst(),
+	})
+}
+
+func (l Limit) Validate() error {
+	if l.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %d", l.Rate)
+	}
+	if l.Period <= 0 {
+		return fmt.Errorf("period must be positive, got %s", l.Period)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("burst must not be negative, got %d", l.Burst)
+	}
+	return nil
+}
+
+func (l Limit) burst() int {
+	if l.Burst == 0 {
+		return l.Rate
+	}
+	return l.Burst
+}
+
+// emissionInterval is the time it takes to earn back one request.
+func (l Limit) emissionInterval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+// Policy renders the limit for the RateLimit-Policy header.
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d;burst=%d", l.Rate, int(math.Ceil(l.Period.Seconds())), l.burst())
+}
+
+// ClientIPClass is checked per client IP on every request, before the route
+// class, so unauthenticated floods are throttled too.
+const ClientIPClass = "client_ip"
+
+// Result is the outcome of one rate limit check.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests the key may send back to back.
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a rejected caller has to wait; zero when allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the full burst is available again.
+	ResetAfter time.Duration
+}
+
+// Limiter checks and consumes one request for key under limit.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Rules holds the named rate limit classes routes refer to and can be
+// swapped atomically when the runtime config changes.
+type Rules struct {
+	classes atomic.Pointer[map[string]Limit]
+}
+
+func NewRules(classes map[string]Limit) *Rules {
+	r := &Rules{}
+	r.Store(classes)
+	return r
+}
+
+func (r *Rules) Store(classes map[string]Limit) {
+	cloned := make(map[string]Limit, len(classes))
+	for k, v := range classes {
+		cloned[k] = v
+	}
+	r.classes.Store(&cloned)
+}
+
+func (r *Rules) Lookup(class string) (Limit, bool) {
+	limit, ok := (*r.classes.Load())[class]
+	return limit, ok
+}
+
+var (
+	rejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limited_total",
+		Help: "Requests rejected by the rate limiter, by route template.",
+	}, []string{"route"})
+
+	fallbackChecks = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_rate_limit_fallback_total",
+		Help: "Rate limit checks served by the in-process limiter because Redis was unavailable.",
+	})
+)
+
+// ObserveRejected counts a request rejected on route.
+func ObserveRejected(route string) {
+	rejected.WithLabelValues(route).Inc()
+}
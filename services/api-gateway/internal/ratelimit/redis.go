@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcra implements the generic cell rate algorithm. The key stores the
+// theoretical arrival time (TAT) of the next request, so every client needs
+// a single key no matter the window. Redis' clock is used so that gateway
+// replicas with skewed clocks agree. Fractional values are returned as
+// strings because Redis truncates Lua numbers to integers.
+var gcra = redis.NewScript(`
+local key = KEYS[1]
+local emission_interval = tonumber(ARGV[1])
+local burst_offset = tonumber(ARGV[2])
+
+redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local tat = tonumber(redis.call("GET", key))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + emission_interval
+local diff = now - (new_tat - burst_offset)
+
+if diff < 0 then
+  return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+
+local reset_after = new_tat - now
+redis.call("SET", key, tostring(new_tat), "PX", math.ceil(reset_after * 1000))
+return {1, math.floor(diff / emission_interval), "0", tostring(reset_after)}
+`)
+
+// RedisLimiter shares limits between every gateway replica.
+type RedisLimiter struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func NewRedisLimiter(rdb *redis.Client) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb, prefix: "ratelimit:"}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	emission := limit.emissionInterval()
+	burstOffset := emission * time.Duration(limit.burst())
+
+	values, err := gcra.Run(ctx, l.rdb, []string{l.prefix + key}, emission.Seconds(), burstOffset.Seconds()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply: %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	retryAfter, err := parseSeconds(values[2])
+	if err != nil {
+		return Result{}, err
+	}
+	resetAfter, err := parseSeconds(values[3])
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    allowed == 1,
+		Limit:      limit.burst(),
+		Remaining:  int(remaining),
+		RetryAfter: retryAfter,
+		ResetAfter: resetAfter,
+	}, nil
+}
+
+func parseSeconds(v any) (time.Duration, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected rate limit script value %v", v)
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,311 @@
+package realtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ms-ride-sharing/shared/authz"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// StreamRoutes lists, in METHOD:/template form, the POST routes of the RPCs
+// in files that take a client stream. Those are the routes Bridge serves: a
+// WebSocket handshake is a GET and is forwarded as the POST of the RPC.
+func StreamRoutes(files ...protoreflect.FileDescriptor) map[string]bool {
+	routes := map[string]bool{}
+	for _, file := range files {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				if !method.IsStreamingClient() {
+					continue
+				}
+				for _, route := range authz.HTTPRoutes(method) {
+					if strings.HasPrefix(route, http.MethodPost+":") {
+						routes[route] = true
+					}
+				}
+			}
+		}
+	}
+	return routes
+}
+
+var errInvalidMessage = errors.New("websocket message is not valid json")
+
+const problemContentType = "application/problem+json"
+
+// ErrorCode describes a gRPC error as the HTTP status and stable code the
+// gateway reports it with.
+type ErrorCode func(*grpcstatus.Status) (int, string)
+
+// Bridge upgrades r and runs serve, a grpc-gateway streaming handler, over
+// the connection. Each WebSocket message is one JSON request message and
+// each streamed response is sent back as one message. An empty message ends
+// the client side of the stream, which client-streaming RPCs wait for before
+// answering.
+//
+// The connection is closed with 1000 when the RPC ends and with 4000 plus
+// the HTTP status when it fails, e.g. 4401, with the error code as reason.
+// Route timeouts do not apply; streams are bounded by the idle timeout.
+func (p *Proxy) Bridge(w http.ResponseWriter, r *http.Request, route string, serve func(http.ResponseWriter, *http.Request), errorCode ErrorCode) {
+	handshake := *r
+	handshake.Method = http.MethodGet
+	conn, err := p.upgrader.Upgrade(w, &handshake, nil)
+	if err != nil {
+		// Upgrade already answered the client.
+		return
+	}
+	defer conn.Close()
+
+	connections.WithLabelValues(route).Inc()
+	defer connections.WithLabelValues(route).Dec()
+
+	if p.limits.MaxMessageBytes > 0 {
+		conn.SetReadLimit(p.limits.MaxMessageBytes)
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	body, bodyWriter := io.Pipe()
+	clientDone := make(chan struct{})
+	go p.readStream(conn, bodyWriter, route, &lastActivity, clientDone)
+
+	out := &streamWriter{
+		proxy:        p,
+		conn:         conn,
+		route:        route,
+		header:       http.Header{},
+		errorCode:    errorCode,
+		lastActivity: &lastActivity,
+	}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		// Unblocks readStream if the handler stopped reading early.
+		defer body.Close()
+
+		req := r.WithContext(ctx)
+		req.Body = body
+		req.ContentLength = -1
+		// Trailers would make unary responses look like streams.
+		req.Header = r.Header.Clone()
+		req.Header.Del("Te")
+		serve(out, req)
+		out.finish()
+	}()
+
+	var idle <-chan time.Time
+	if p.limits.IdleTimeout > 0 {
+		ticker := time.NewTicker(min(p.limits.IdleTimeout/4, time.Second))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+	shutdown := p.shutdown
+	var grace <-chan time.Time
+
+	for served != nil || clientDone != nil {
+		select {
+		case <-served:
+			served = nil
+			code, reason := out.closeCode()
+			p.writeClose(conn, code, reason)
+			// Give the client a moment to answer the close frame.
+			grace = time.After(closeGrace)
+		case <-clientDone:
+			// The client closed or went away; nobody is left to read the
+			// rest of the stream.
+			clientDone = nil
+			cancel()
+		case <-idle:
+			if time.Since(time.Unix(0, lastActivity.Load())) > p.limits.IdleTimeout {
+				out.closeWith(websocket.CloseNormalClosure, "idle timeout")
+				p.writeClose(conn, websocket.CloseNormalClosure, "idle timeout")
+				cancel()
+				idle = nil
+			}
+		case <-shutdown:
+			out.closeWith(websocket.CloseGoingAway, "server shutting down")
+			p.writeClose(conn, websocket.CloseGoingAway, "server shutting down")
+			cancel()
+			shutdown = nil
+		case <-grace:
+			conn.Close()
+			grace = nil
+		}
+	}
+}
+
+// readStream feeds client messages to the request body, one JSON value per
+// line as grpc-gateway decodes it.
+func (p *Proxy) readStream(conn *websocket.Conn, body *io.PipeWriter, route string, lastActivity *atomic.Int64, done chan<- struct{}) {
+	defer close(done)
+
+	halfClosed := false
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			body.CloseWithError(err)
+			return
+		}
+		lastActivity.Store(time.Now().UnixNano())
+
+		switch {
+		case halfClosed:
+			p.writeClose(conn, websocket.ClosePolicyViolation, "message after end of stream")
+		case len(data) == 0:
+			halfClosed = true
+			body.Close()
+		case !json.Valid(data):
+			p.writeClose(conn, websocket.CloseInvalidFramePayloadData, "message is not valid json")
+			halfClosed = true
+			body.CloseWithError(errInvalidMessage)
+		default:
+			messages.WithLabelValues(route, "inbound").Inc()
+			if _, err := body.Write(append(data, '\n')); err != nil {
+				// The RPC is over; keep reading until the client answers
+				// the close frame.
+				halfClosed = true
+			}
+		}
+	}
+}
+
+// streamWriter turns what grpc-gateway writes into WebSocket messages:
+// newline delimited {"result": ...} and {"error": ...} chunks for server
+// streams, a single message for client streams, or a problem document when
+// the call failed before it started.
+type streamWriter struct {
+	proxy        *Proxy
+	conn         *websocket.Conn
+	route        string
+	header       http.Header
+	errorCode    ErrorCode
+	lastActivity *atomic.Int64
+	buf          bytes.Buffer
+
+	mu     sync.Mutex
+	failed bool
+	code   int
+	reason string
+}
+
+func (s *streamWriter) Header() http.Header { return s.header }
+
+func (s *streamWriter) WriteHeader(int) {}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	return s.buf.Write(b)
+}
+
+// FlushError is called by grpc-gateway after every chunk of a server stream.
+func (s *streamWriter) FlushError() error {
+	defer s.buf.Reset()
+
+	dec := json.NewDecoder(&s.buf)
+	for {
+		var chunk struct {
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		err := dec.Decode(&chunk)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			s.fail(http.StatusInternalServerError, "INTERNAL")
+			return err
+		}
+
+		if chunk.Error != nil {
+			var st status.Status
+			if err := protojson.Unmarshal(chunk.Error, &st); err != nil {
+				s.fail(http.StatusInternalServerError, "INTERNAL")
+				return err
+			}
+			s.fail(s.errorCode(grpcstatus.FromProto(&st)))
+			return nil
+		}
+		if err := s.send(chunk.Result); err != nil {
+			return err
+		}
+	}
+}
+
+// finish handles what the handler wrote after its last flush.
+func (s *streamWriter) finish() {
+	switch {
+	case strings.HasPrefix(s.header.Get("Content-Type"), problemContentType):
+		var problem struct {
+			Status int    `json:"status"`
+			Code   string `json:"code"`
+		}
+		if err := json.Unmarshal(s.buf.Bytes(), &problem); err != nil || problem.Status == 0 {
+			problem.Status, problem.Code = http.StatusInternalServerError, "INTERNAL"
+		}
+		s.fail(problem.Status, problem.Code)
+	case s.header.Get("Transfer-Encoding") == "chunked":
+		s.FlushError()
+	case s.buf.Len() > 0:
+		s.send(s.buf.Bytes())
+	}
+	s.buf.Reset()
+}
+
+func (s *streamWriter) send(message []byte) error {
+	if s.proxy.limits.WriteTimeout > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.proxy.limits.WriteTimeout))
+	}
+	if err := s.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		return err
+	}
+	s.lastActivity.Store(time.Now().UnixNano())
+	messages.WithLabelValues(s.route, "outbound").Inc()
+	return nil
+}
+
+func (s *streamWriter) fail(httpStatus int, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.failed {
+		s.failed = true
+		s.code, s.reason = 4000+httpStatus, code
+	}
+}
+
+// closeWith records a close initiated by the proxy, which takes precedence
+// over the error the aborted RPC reports.
+func (s *streamWriter) closeWith(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.code, s.reason = code, reason
+}
+
+func (s *streamWriter) closeCode() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed {
+		return s.code, s.reason
+	}
+	return websocket.CloseNormalClosure, ""
+}
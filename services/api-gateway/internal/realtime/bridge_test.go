@@ -0,0 +1,169 @@
+package realtime
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// echoStream stands in for a generated grpc-gateway handler of a
+// bidirectional RPC: it reads the request stream to the end, as the bridge
+// delivers it, and streams every message back. A message "fail" ends the RPC
+// with PermissionDenied instead.
+func echoStream(mux *runtime.ServeMux) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var requests []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var msg wrapperspb.StringValue
+			if err := protojson.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				runtime.HTTPError(r.Context(), mux, &runtime.JSONPb{}, w, r, grpcstatus.Error(codes.InvalidArgument, err.Error()))
+				return
+			}
+			requests = append(requests, msg.GetValue())
+		}
+
+		ctx := runtime.NewServerMetadataContext(r.Context(), runtime.ServerMetadata{})
+		runtime.ForwardResponseStream(ctx, mux, &runtime.JSONPb{}, w, r, func() (proto.Message, error) {
+			if len(requests) == 0 {
+				return nil, io.EOF
+			}
+			next := requests[0]
+			requests = requests[1:]
+			if next == "fail" {
+				return nil, grpcstatus.Error(codes.PermissionDenied, "not allowed")
+			}
+			return wrapperspb.String(strings.ToUpper(next)), nil
+		})
+	}
+}
+
+// sumStream stands in for a client-streaming RPC: one response once the
+// client ends its stream.
+func sumStream(mux *runtime.ServeMux) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var joined []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var msg wrapperspb.StringValue
+			if err := protojson.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				runtime.HTTPError(r.Context(), mux, &runtime.JSONPb{}, w, r, grpcstatus.Error(codes.InvalidArgument, err.Error()))
+				return
+			}
+			joined = append(joined, msg.GetValue())
+		}
+		ctx := runtime.NewServerMetadataContext(r.Context(), runtime.ServerMetadata{})
+		runtime.ForwardResponseMessage(ctx, mux, &runtime.JSONPb{}, w, r, wrapperspb.String(strings.Join(joined, "+")))
+	}
+}
+
+func errorCode(st *grpcstatus.Status) (int, string) {
+	return runtime.HTTPStatusFromCode(st.Code()), strings.ToUpper(st.Code().String())
+}
+
+func TestBridge(t *testing.T) {
+	tests := []struct {
+		name       string
+		serve      func(*runtime.ServeMux) func(http.ResponseWriter, *http.Request)
+		send       []string
+		want       []string
+		wantCode   int
+		wantReason string
+	}{
+		{
+			name:     "server stream",
+			serve:    echoStream,
+			send:     []string{`"a"`, `"b"`, ""},
+			want:     []string{`"A"`, `"B"`},
+			wantCode: websocket.CloseNormalClosure,
+		},
+		{
+			name:     "empty stream",
+			serve:    echoStream,
+			send:     []string{""},
+			wantCode: websocket.CloseNormalClosure,
+		},
+		{
+			name:       "error after a message",
+			serve:      echoStream,
+			send:       []string{`"a"`, `"fail"`, `"b"`, ""},
+			want:       []string{`"A"`},
+			wantCode:   4000 + http.StatusForbidden,
+			wantReason: "PERMISSIONDENIED",
+		},
+		{
+			name:     "client stream",
+			serve:    sumStream,
+			send:     []string{`"a"`, `"b"`, ""},
+			want:     []string{`"a+b"`},
+			wantCode: websocket.CloseNormalClosure,
+		},
+		{
+			name:       "invalid message",
+			serve:      sumStream,
+			send:       []string{`"a"`, `{`},
+			wantCode:   websocket.CloseInvalidFramePayloadData,
+			wantReason: "message is not valid json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := NewProxy(Limits{WriteTimeout: time.Second}, nil)
+			mux := runtime.NewServeMux()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.Method = http.MethodPost
+				proxy.Bridge(w, r, "/test", tt.serve(mux), errorCode)
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, _, err := websocket.DefaultDialer.DialContext(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			for _, msg := range tt.send {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+					t.Fatalf("write %q: %v", msg, err)
+				}
+			}
+
+			var got []string
+			for {
+				_, data, err := conn.ReadMessage()
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					if closeErr.Code != tt.wantCode || closeErr.Text != tt.wantReason {
+						t.Errorf("closed with %d %q, want %d %q", closeErr.Code, closeErr.Text, tt.wantCode, tt.wantReason)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("read: %v", err)
+				}
+				got = append(got, string(data))
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
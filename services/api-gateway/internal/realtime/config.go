@@ -0,0 +1,95 @@
+package realtime
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"ms-ride-sharing/services/api-gateway/internal/upstream"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Route forwards WebSocket connections opened on Path to Backend.
+type Route struct {
+	// Path is matched exactly, e.g. /realtime.
+	Path string `yaml:"path"`
+	// Backend is the ws:// or wss:// URL every connection is relayed to.
+	Backend string `yaml:"backend"`
+	// Public routes accept anonymous connections. The others need an access
+	// token or a ticket from POST /api/v1/auth/ws-ticket and, when Roles is
+	// set, one of those user types.
+	Public bool     `yaml:"public"`
+	Roles  []string `yaml:"roles"`
+	// TLS presents the gateway certificate to wss:// backends.
+	TLS upstream.TLS `yaml:"tls"`
+	// RateLimit is the rate limit class of the handshake, DefaultRateLimit
+	// when empty.
+	RateLimit string `yaml:"rate_limit"`
+}
+
+const DefaultRateLimit = "websocket"
+
+// LoadRoutes reads the "websockets" list of the upstreams file, next to the
+// gRPC upstreams. An empty path returns no routes.
+func LoadRoutes(path string) ([]Route, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading upstreams file: %w", err)
+	}
+
+	var file struct {
+		WebSockets []Route `yaml:"websockets"`
+	}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parsing upstreams file %s: %w", path, err)
+	}
+	for i := range file.WebSockets {
+		if file.WebSockets[i].RateLimit == "" {
+			file.WebSockets[i].RateLimit = DefaultRateLimit
+		}
+	}
+	return file.WebSockets, nil
+}
+
+// ValidateRoutes checks routes on their own and against the known roles.
+// tlsAvailable reports whether the gateway has a certificate to present.
+func ValidateRoutes(routes []Route, roles []string, tlsAvailable bool) error {
+	paths := map[string]bool{}
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/") || strings.ContainsAny(route.Path, "{}") {
+			return fmt.Errorf("websocket route %q: path must be a literal starting with /", route.Path)
+		}
+		if paths[route.Path] {
+			return fmt.Errorf("websocket route %s is defined more than once", route.Path)
+		}
+		paths[route.Path] = true
+
+		backend, err := url.Parse(route.Backend)
+		if err != nil || (backend.Scheme != "ws" && backend.Scheme != "wss") || backend.Host == "" {
+			return fmt.Errorf("websocket route %s: backend %q must be a ws:// or wss:// URL", route.Path, route.Backend)
+		}
+		if route.TLS.Enabled && backend.Scheme != "wss" {
+			return fmt.Errorf("websocket route %s: tls requires a wss:// backend", route.Path)
+		}
+		if route.TLS.Enabled && !tlsAvailable {
+			return fmt.Errorf("websocket route %s: tls requires GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE and GRPC_TLS_CA_FILE", route.Path)
+		}
+
+		if route.Public && len(route.Roles) > 0 {
+			return fmt.Errorf("websocket route %s: public routes cannot restrict roles", route.Path)
+		}
+		for _, role := range route.Roles {
+			if !slices.Contains(roles, role) {
+				return fmt.Errorf("websocket route %s: unknown role %q, expected one of %s", route.Path, role, strings.Join(roles, ", "))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+// Package realtime relays WebSocket connections from clients to backend
+// services. The gateway terminates both sides and forwards message by
+// message, so it can cap message sizes, close idle connections and say
+// goodbye properly when it shuts down.
+package realtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ms-ride-sharing/shared/mtls"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	handshakeTimeout = 10 * time.Second
+	// closeGrace is how long a peer has to answer a close frame before the
+	// connection is dropped.
+	closeGrace = 5 * time.Second
+	// closeBadGateway is the close code for a backend that went away
+	// (registered in the IANA WebSocket close code registry).
+	closeBadGateway = 1014
+)
+
+var (
+	ErrDraining           = errors.New("gateway is shutting down")
+	ErrTooManyConnections = errors.New("too many websocket connections")
+	errNoCertificate      = errors.New("backend tls requires a gateway certificate")
+)
+
+var (
+	connections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_websocket_connections",
+		Help: "Open WebSocket connections, by route.",
+	}, []string{"route"})
+	messages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_websocket_messages_total",
+		Help: "WebSocket messages relayed, by route and direction (inbound is client to backend).",
+	}, []string{"route", "direction"})
+)
+
+// Limits bound each relayed connection. Zero values disable a limit.
+type Limits struct {
+	// IdleTimeout closes connections without messages in either direction.
+	// Pings are answered but do not count as activity.
+	IdleTimeout     time.Duration
+	MaxMessageBytes int64
+	// MaxConnsPerUser caps the connections of a user, or of a client IP on
+	// public routes, on this gateway replica.
+	MaxConnsPerUser int
+	WriteTimeout    time.Duration
+}
+
+// Proxy relays WebSocket connections and keeps track of them for Shutdown.
+type Proxy struct {
+	limits   Limits
+	certs    *mtls.Source
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	owners   map[string]int
+	draining bool
+	sessions sync.WaitGroup
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewProxy creates a proxy; certs may be nil when no route uses tls.
+func NewProxy(limits Limits, certs *mtls.Source) *Proxy {
+	return &Proxy{
+		limits: limits,
+		certs:  certs,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: handshakeTimeout,
+			// The origin is checked against the CORS policy before the
+			// handshake gets here.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		owners:   map[string]int{},
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Acquire reserves a connection for owner. release must be called once the
+// connection is over, or when it could not be opened.
+func (p *Proxy) Acquire(owner string) (release func(), err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.draining {
+		return nil, ErrDraining
+	}
+	if p.limits.MaxConnsPerUser > 0 && p.owners[owner] >= p.limits.MaxConnsPerUser {
+		return nil, ErrTooManyConnections
+	}
+	p.owners[owner]++
+	p.sessions.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.owners[owner]--; p.owners[owner] <= 0 {
+				delete(p.owners, owner)
+			}
+			p.sessions.Done()
+		})
+	}, nil
+}
+
+// Dial opens the backend side of a connection to route, offering the
+// subprotocols the client asked for.
+func (p *Proxy) Dial(ctx context.Context, route Route, header http.Header, subprotocols []string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: handshakeTimeout,
+		Subprotocols:     subprotocols,
+	}
+	if route.TLS.Enabled {
+		if p.certs == nil {
+			return nil, errNoCertificate
+		}
+		serverName := route.TLS.ServerName
+		if serverName == "" {
+			if u, err := url.Parse(route.Backend); err == nil {
+				serverName = u.Hostname()
+			}
+		}
+		dialer.TLSClientConfig = p.certs.ClientConfig(serverName, route.TLS.AllowedPeers)
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, route.Backend, header)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	return conn, err
+}
+
+// Relay completes the client handshake with the subprotocol the backend
+// picked and forwards messages both ways until either side closes, the
+// connection idles out or the proxy shuts down. It owns backend.
+func (p *Proxy) Relay(w http.ResponseWriter, r *http.Request, route string, backend *websocket.Conn) {
+	header := http.Header{}
+	if subprotocol := backend.Subprotocol(); subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	client, err := p.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		// Upgrade already answered the client.
+		backend.Close()
+		return
+	}
+	defer client.Close()
+	defer backend.Close()
+
+	connections.WithLabelValues(route).Inc()
+	defer connections.WithLabelValues(route).Dec()
+
+	if p.limits.MaxMessageBytes > 0 {
+		client.SetReadLimit(p.limits.MaxMessageBytes)
+		backend.SetReadLimit(p.limits.MaxMessageBytes)
+	}
+
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+	done := make(chan struct{}, 2)
+	go p.pump(client, backend, false, route, "inbound", &lastActivity, done)
+	go p.pump(backend, client, true, route, "outbound", &lastActivity, done)
+
+	closeBoth := func(code int, reason string) {
+		p.writeClose(client, code, reason)
+		p.writeClose(backend, code, reason)
+	}
+
+	var idle <-chan time.Time
+	if p.limits.IdleTimeout > 0 {
+		ticker := time.NewTicker(min(p.limits.IdleTimeout/4, time.Second))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+	shutdown := p.shutdown
+	var grace <-chan time.Time
+
+	for finished := 0; finished < 2; {
+		select {
+		case <-done:
+			// One side is gone; the other was told to close and gets a
+			// moment to answer.
+			finished++
+			if grace == nil {
+				grace = time.After(closeGrace)
+			}
+		case <-idle:
+			if time.Since(time.Unix(0, lastActivity.Load())) > p.limits.IdleTimeout {
+				closeBoth(websocket.CloseNormalClosure, "idle timeout")
+				idle = nil
+				grace = time.After(closeGrace)
+			}
+		case <-shutdown:
+			closeBoth(websocket.CloseGoingAway, "server shutting down")
+			shutdown = nil
+			grace = time.After(closeGrace)
+		case <-grace:
+			client.Close()
+			backend.Close()
+		}
+	}
+}
+
+// pump forwards messages from src to dst. When src ends, dst is closed with
+// the code src gave or, if it just went away, one saying which side failed.
+func (p *Proxy) pump(src, dst *websocket.Conn, fromBackend bool, route, direction string, lastActivity *atomic.Int64, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	for {
+		kind, data, err := src.ReadMessage()
+		if err != nil {
+			code, reason := closeCode(err, fromBackend)
+			p.writeClose(dst, code, reason)
+			return
+		}
+		lastActivity.Store(time.Now().UnixNano())
+		messages.WithLabelValues(route, direction).Inc()
+
+		if p.limits.WriteTimeout > 0 {
+			dst.SetWriteDeadline(time.Now().Add(p.limits.WriteTimeout))
+		}
+		if err := dst.WriteMessage(kind, data); err != nil {
+			return
+		}
+	}
+}
+
+func (p *Proxy) writeClose(conn *websocket.Conn, code int, reason string) {
+	timeout := p.limits.WriteTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	// Fails harmlessly when a close frame was already sent.
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(timeout))
+}
+
+// closeCode picks the close frame for the peer of a side that ended with
+// err. Codes that only describe a local condition cannot be sent on.
+func closeCode(err error, fromBackend bool) (int, string) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case websocket.CloseNoStatusReceived:
+			return websocket.CloseNormalClosure, ""
+		case websocket.CloseAbnormalClosure, websocket.CloseTLSHandshake:
+		default:
+			return closeErr.Code, closeErr.Text
+		}
+	}
+	reason := "connection lost"
+	if errors.Is(err, websocket.ErrReadLimit) {
+		reason = "message too big"
+	}
+	if fromBackend {
+		return closeBadGateway, "upstream " + reason
+	}
+	return websocket.CloseGoingAway, "client " + reason
+}
+
+// Shutdown stops accepting connections, asks every open one to close with
+// 1001 (going away) and waits for them until ctx is done.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.draining = true
+	p.mu.Unlock()
+	p.shutdownOnce.Do(func() { close(p.shutdown) })
+
+	finished := make(chan struct{})
+	go func() {
+		p.sessions.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"ms-ride-sharing/shared/logger"
+	"ms-ride-sharing/shared/session"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_session_cache_lookups_total",
+	Help: "Session validations, by whether they were served from the local cache.",
+}, []string{"result"})
+
+// Validator checks that an access token belongs to the current session of
+// its user. Validated JTIs are cached for ttl, which bounds how long a
+// revoked token keeps working if a revocation message is lost.
+type Validator struct {
+	rdb  *redis.Client
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	userID    string
+	jti       string
+	expiresAt time.Time
+}
+
+// NewValidator caches up to size sessions. A zero size or ttl disables the
+// cache, so every validation goes to Redis.
+func NewValidator(rdb *redis.Client, size int, ttl time.Duration) *Validator {
+	return &Validator{
+		rdb:     rdb,
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Valid reports whether jti is the active access token of userID.
+func (v *Validator) Valid(ctx context.Context, userID, jti string) (bool, error) {
+	if v.cached(userID, jti) {
+		lookups.WithLabelValues("hit").Inc()
+		return true, nil
+	}
+	lookups.WithLabelValues("miss").Inc()
+
+	active, err := v.rdb.Get(ctx, "session:"+userID).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if active != jti {
+		return false, nil
+	}
+
+	v.store(userID, jti)
+	return true, nil
+}
+
+// RedeemTicket consumes a WebSocket ticket issued by user-service. The
+// session it names must still be checked with Valid.
+func (v *Validator) RedeemTicket(ctx context.Context, ticket string) (session.Ticket, bool, error) {
+	return session.RedeemTicket(ctx, v.rdb, ticket)
+}
+
+func (v *Validator) cached(userID, jti string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	el, ok := v.entries[userID]
+	if !ok {
+		return false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		v.order.Remove(el)
+		delete(v.entries, userID)
+		return false
+	}
+	if e.jti != jti {
+		return false
+	}
+	v.order.MoveToFront(el)
+	return true
+}
+
+func (v *Validator) store(userID, jti string) {
+	if v.size <= 0 || v.ttl <= 0 {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	e := &entry{userID: userID, jti: jti, expiresAt: time.Now().Add(v.ttl)}
+	if el, ok := v.entries[userID]; ok {
+		el.Value = e
+		v.order.MoveToFront(el)
+		return
+	}
+
+	v.entries[userID] = v.order.PushFront(e)
+	for v.order.Len() > v.size {
+		oldest := v.order.Back()
+		v.order.Remove(oldest)
+		delete(v.entries, oldest.Value.(*entry).userID)
+	}
+}
+
+// Invalidate drops the cached session of userID.
+func (v *Validator) Invalidate(userID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if el, ok := v.entries[userID]; ok {
+		v.order.Remove(el)
+		delete(v.entries, userID)
+	}
+}
+
+// Purge drops every cached session.
+func (v *Validator) Purge() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.order.Init()
+	clear(v.entries)
+}
+
+// Listen invalidates cached sessions as user-service announces changes,
+// until ctx is done. Messages published while the subscription is down are
+// lost, so the whole cache is purged every time it is (re)established.
+func (v *Validator) Listen(ctx context.Context) {
+	pubsub := v.rdb.Subscribe(ctx, session.RevocationChannel)
+	defer pubsub.Close()
+
+	failing := false
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !failing {
+				slog.Warn("session revocation subscription failed, purging cache", logger.Err(err))
+				failing = true
+			}
+			v.Purge()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind == "subscribe" {
+				if failing {
+					slog.Info("session revocation subscription restored")
+					failing = false
+				}
+				v.Purge()
+			}
+		case *redis.Message:
+			v.Invalidate(m.Payload)
+		}
+	}
+}
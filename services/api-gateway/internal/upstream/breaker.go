@@ -0,0 +1,217 @@
+package upstream
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"ms-ride-sharing/shared/grpcx"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ErrorDomain               = "api-gateway"
+	ReasonUpstreamUnavailable = "UPSTREAM_UNAVAILABLE"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+var (
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_circuit_breaker_state",
+		Help: "Circuit breaker state per upstream: 0 closed, 1 half-open, 2 open.",
+	}, []string{"upstream"})
+
+	breakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_circuit_breaker_transitions_total",
+		Help: "Circuit breaker state changes per upstream.",
+	}, []string{"upstream", "from", "to"})
+
+	breakerRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_circuit_breaker_rejected_total",
+		Help: "Calls failed fast because the circuit breaker of the upstream was open.",
+	}, []string{"upstream"})
+)
+
+// Breaker stops calling an upstream after threshold consecutive failures.
+// It stays open for openFor, then lets a single probe call through: success
+// closes it again, failure reopens it. Only errors that say the upstream is
+// unreachable or overloaded count as failures; a business error such as
+// InvalidArgument means the upstream is working.
+type Breaker struct {
+	name      string
+	threshold int
+	openFor   time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewBreaker(name string, threshold int, openFor time.Duration) *Breaker {
+	breakerState.WithLabelValues(name).Set(float64(StateClosed))
+	return &Breaker{name: name, threshold: threshold, openFor: openFor}
+}
+
+// allow reports whether a call may go through and, when it may not, how
+// long until the breaker lets a probe through.
+func (b *Breaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		remaining := b.openFor - time.Since(b.openedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		b.transition(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probing {
+			return false, time.Second
+		}
+		b.probing = true
+	}
+	return true, 0
+}
+
+// record reports the outcome of a call let through by allow.
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == StateHalfOpen
+	if probe {
+		b.probing = false
+	}
+
+	switch {
+	case status.Code(err) == codes.DeadlineExceeded && callerDeadline(ctx):
+		// The caller asked for less time than the route allows, e.g. with
+		// Grpc-Timeout; counting it would let any client open the breaker.
+	case isFailure(err):
+		b.failures++
+		if probe || b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			b.transition(StateOpen)
+		}
+	case status.Code(err) == codes.Canceled:
+		// The caller went away; this says nothing about the upstream.
+	default:
+		b.failures = 0
+		if probe {
+			b.transition(StateClosed)
+		}
+	}
+}
+
+func (b *Breaker) transition(to State) {
+	if b.state == to {
+		return
+	}
+	from := b.state
+	b.state = to
+	if to == StateClosed {
+		b.failures = 0
+	}
+
+	breakerState.WithLabelValues(b.name).Set(float64(to))
+	breakerTransitions.WithLabelValues(b.name, from.String(), to.String()).Inc()
+	slog.Warn("circuit breaker state changed",
+		slog.String("upstream", b.name),
+		slog.String("from", from.String()),
+		slog.String("to", to.String()),
+	)
+}
+
+type deadlineKey struct{}
+
+// WithTimeout is context.WithTimeout for the deadline the gateway itself
+// gives an upstream call, the route timeout. Deadlines shorter than it come
+// from the client and do not count against the breaker.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	deadline, _ := ctx.Deadline()
+	return context.WithValue(ctx, deadlineKey{}, deadline), cancel
+}
+
+// callerDeadline reports whether the deadline of ctx is earlier than the one
+// set with WithTimeout, or was set without it.
+func callerDeadline(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	own, ok := ctx.Value(deadlineKey{}).(time.Time)
+	return !ok || deadline.Before(own)
+}
+
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+func (b *Breaker) rejected(retryAfter time.Duration) error {
+	breakerRejected.WithLabelValues(b.name).Inc()
+	retryAfter = time.Duration(math.Ceil(retryAfter.Seconds())) * time.Second
+	return grpcx.NewError(codes.Unavailable, ReasonUpstreamUnavailable, ErrorDomain, b.name+" is unavailable", retryAfter)
+}
+
+// UnaryClientInterceptor fails calls fast while the breaker is open. Retries
+// from the service config happen below interceptors, so a call counts once
+// no matter how many attempts it took.
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ok, retryAfter := b.allow()
+		if !ok {
+			return b.rejected(retryAfter)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(ctx, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor does the same for streams, judging the upstream
+// only on whether the stream could be opened.
+func (b *Breaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ok, retryAfter := b.allow()
+		if !ok {
+			return nil, b.rejected(retryAfter)
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		b.record(ctx, err)
+		return stream, err
+	}
+}
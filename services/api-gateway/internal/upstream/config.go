@@ -0,0 +1,55 @@
+package upstream
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes one backend the gateway forwards to.
+type Config struct {
+	Name string `yaml:"name"`
+	// Addresses are gRPC targets. A single host:port is resolved through DNS,
+	// so a headless Kubernetes service spreads calls over every pod; several
+	// addresses are balanced as a static list.
+	Addresses []string `yaml:"addresses"`
+	// Services are the fully qualified proto services served by the upstream,
+	// e.g. ridesharing.v1.UserService. Each must be known to the gateway.
+	Services []string `yaml:"services"`
+	TLS      TLS      `yaml:"tls"`
+	// Lazy upstreams are only connected on the first request; until then the
+	// health check leaves them idle instead of dialing them.
+	Lazy bool `yaml:"lazy"`
+}
+
+// TLS enables mTLS with the gateway certificate (GRPC_TLS_* settings).
+type TLS struct {
+	Enabled bool `yaml:"enabled"`
+	// ServerName overrides the name checked against the certificate.
+	ServerName string `yaml:"server_name"`
+	// AllowedPeers are the identities the upstream may present: SPIFFE URI
+	// SANs or common names. When set, they replace the server name check.
+	AllowedPeers []string `yaml:"allowed_peers"`
+}
+
+// LoadConfigs reads the upstreams file. The file holds a single "upstreams"
+// list; an empty path returns defaults.
+func LoadConfigs(path string, defaults []Config) ([]Config, error) {
+	if path == "" {
+		return defaults, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading upstreams file: %w", err)
+	}
+
+	var file struct {
+		Upstreams []Config `yaml:"upstreams"`
+	}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("parsing upstreams file %s: %w", path, err)
+	}
+	return file.Upstreams, nil
+}
@@ -0,0 +1,244 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ms-ride-sharing/services/api-gateway/internal/webrpc"
+	"ms-ride-sharing/shared/grpcx"
+	"ms-ride-sharing/shared/health"
+	"ms-ride-sharing/shared/mtls"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Service binds a proto service to its generated grpc-gateway handler, e.g.
+// userpb.RegisterUserServiceHandler.
+type Service struct {
+	File     protoreflect.FileDescriptor
+	Register func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+}
+
+// Options are shared by every upstream of a registry.
+type Options struct {
+	Retry            grpcx.RetryPolicy
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// Certs is required by upstreams with tls enabled.
+	Certs *mtls.Source
+	// DialOptions are appended to the ones built for each upstream.
+	DialOptions []grpc.DialOption
+}
+
+type Upstream struct {
+	cfg      Config
+	services []Service
+	conn     *grpc.ClientConn
+	breaker  *Breaker
+}
+
+// Registry holds one client connection per configured upstream. Connections
+// are created idle and dialed on the first call.
+type Registry struct {
+	upstreams []*Upstream
+}
+
+// NewRegistry validates configs against catalog, which maps fully qualified
+// service names to their handlers, and creates a connection per upstream.
+func NewRegistry(configs []Config, catalog map[string]Service, opts Options) (*Registry, error) {
+	if err := validate(configs, catalog); err != nil {
+		return nil, err
+	}
+
+	r := &Registry{}
+	for _, cfg := range configs {
+		u, err := newUpstream(cfg, catalog, opts)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("upstream %s: %w", cfg.Name, err)
+		}
+		r.upstreams = append(r.upstreams, u)
+	}
+	return r, nil
+}
+
+func validate(configs []Config, catalog map[string]Service) error {
+	if len(configs) == 0 {
+		return errors.New("no upstreams configured")
+	}
+
+	names := map[string]bool{}
+	servedBy := map[string]string{}
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			return fmt.Errorf("upstreams[%d]: name is required", i)
+		}
+		if names[cfg.Name] {
+			return fmt.Errorf("upstream %s: duplicate name", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		if len(cfg.Addresses) == 0 {
+			return fmt.Errorf("upstream %s: at least one address is required", cfg.Name)
+		}
+		if len(cfg.Services) == 0 {
+			return fmt.Errorf("upstream %s: at least one service is required", cfg.Name)
+		}
+		for _, name := range cfg.Services {
+			if _, ok := catalog[name]; !ok {
+				return fmt.Errorf("upstream %s: unknown service %q", cfg.Name, name)
+			}
+			if other, ok := servedBy[name]; ok {
+				return fmt.Errorf("upstream %s: service %s is already served by %s", cfg.Name, name, other)
+			}
+			servedBy[name] = cfg.Name
+		}
+	}
+	return nil
+}
+
+func newUpstream(cfg Config, catalog map[string]Service, opts Options) (*Upstream, error) {
+	u := &Upstream{
+		cfg:     cfg,
+		breaker: NewBreaker(cfg.Name, opts.FailureThreshold, opts.OpenTimeout),
+	}
+
+	var files []protoreflect.FileDescriptor
+	for _, name := range cfg.Services {
+		svc := catalog[name]
+		u.services = append(u.services, svc)
+		files = append(files, svc.File)
+	}
+
+	serviceConfig, err := grpcx.ServiceConfig(opts.Retry, files...)
+	if err != nil {
+		return nil, fmt.Errorf("building service config: %w", err)
+	}
+
+	creds := insecure.NewCredentials()
+	if cfg.TLS.Enabled {
+		if opts.Certs == nil {
+			return nil, errors.New("tls is enabled but the gateway has no certificate")
+		}
+		// Like the WebSocket proxy, fall back to the host of the backend:
+		// without a name or allowed peers, any certificate signed by the CA
+		// would be accepted.
+		serverName := cfg.TLS.ServerName
+		if serverName == "" {
+			serverName = targetHost(cfg.Addresses[0])
+		}
+		creds = opts.Certs.ClientCredentials(serverName, cfg.TLS.AllowedPeers)
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(u.breaker.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(u.breaker.StreamClientInterceptor()),
+	}
+
+	target := cfg.Addresses[0]
+	if len(cfg.Addresses) > 1 {
+		// A static list has no resolver of its own; hand it to grpc as the
+		// resolved state so round_robin balances over it.
+		r := manual.NewBuilderWithScheme("static")
+		state := resolver.State{}
+		for _, addr := range cfg.Addresses {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		r.InitialState(state)
+		dialOpts = append(dialOpts, grpc.WithResolvers(r))
+		target = "static:///" + cfg.Name
+	}
+
+	u.conn, err = grpc.NewClient(target, append(dialOpts, opts.DialOptions...)...)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// targetHost is the host of a gRPC target such as user-service:50051 or
+// dns:///user-service:50051.
+func targetHost(target string) string {
+	if _, rest, ok := strings.Cut(target, ":///"); ok {
+		target = rest
+	}
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		return host
+	}
+	return target
+}
+
+// Files returns the proto files of every configured service, for building
+// the auth registry and the route policies of the same routes.
+func (r *Registry) Files() []protoreflect.FileDescriptor {
+	var files []protoreflect.FileDescriptor
+	seen := map[protoreflect.FileDescriptor]bool{}
+	for _, u := range r.upstreams {
+		for _, svc := range u.services {
+			if !seen[svc.File] {
+				seen[svc.File] = true
+				files = append(files, svc.File)
+			}
+		}
+	}
+	return files
+}
+
+// Register mounts the handlers of every configured service on mux: the REST
+// routes of grpc-gateway and the gRPC-Web and Connect endpoints of webrpc,
+// both calling the upstream over the same connection.
+func (r *Registry) Register(ctx context.Context, mux *runtime.ServeMux) error {
+	for _, u := range r.upstreams {
+		for i, svc := range u.services {
+			name := u.cfg.Services[i]
+			if err := svc.Register(ctx, mux, u.conn); err != nil {
+				return fmt.Errorf("registering %s on %s: %w", name, u.cfg.Name, err)
+			}
+
+			service := svc.File.Services().ByName(protoreflect.FullName(name).Name())
+			if service == nil {
+				return fmt.Errorf("service %s is not declared in %s", name, svc.File.Path())
+			}
+			if err := webrpc.Register(mux, u.conn, service); err != nil {
+				return fmt.Errorf("registering %s on %s: %w", name, u.cfg.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Checks returns a health check per upstream.
+func (r *Registry) Checks() []health.Check {
+	checks := make([]health.Check, 0, len(r.upstreams))
+	for _, u := range r.upstreams {
+		check := health.GRPCConnCheck(u.cfg.Name, u.conn)
+		if u.cfg.Lazy {
+			conn, dial := u.conn, check.Check
+			check.Check = func(ctx context.Context) error {
+				if conn.GetState() == connectivity.Idle {
+					return nil
+				}
+				return dial(ctx)
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (r *Registry) Close() {
+	for _, u := range r.upstreams {
+		u.conn.Close()
+	}
+}
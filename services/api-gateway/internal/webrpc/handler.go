@@ -0,0 +1,190 @@
+// Package webrpc serves the RPCs behind the gateway over the gRPC-Web and
+// Connect protocols, for browser clients generated from the proto files.
+// Every RPC is mounted on the grpc-gateway mux at its gRPC path, e.g.
+// POST /ridesharing.v1.UserService/Login, so calls go through the same
+// middleware as the REST routes and reach the upstream over the same
+// connection; only the wire format differs.
+//
+// The gateway speaks HTTP/1.1, so streams are half-duplex: the request is
+// read to the end before responses are sent. Compression is not supported.
+package webrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Register mounts every method of service on mux, calling them on conn.
+func Register(mux *runtime.ServeMux, conn grpc.ClientConnInterface, service protoreflect.ServiceDescriptor) error {
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		if err := mux.HandlePath(http.MethodPost, Path(method), handler(mux, conn, method)); err != nil {
+			return fmt.Errorf("mounting %s: %w", Path(method), err)
+		}
+	}
+	return nil
+}
+
+// Path is the gRPC path of method, e.g. /ridesharing.v1.UserService/Login.
+func Path(method protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+}
+
+func handler(mux *runtime.ServeMux, conn grpc.ClientConnInterface, method protoreflect.MethodDescriptor) runtime.HandlerFunc {
+	path := Path(method)
+	desc := &grpc.StreamDesc{
+		StreamName:    string(method.Name()),
+		ClientStreams: method.IsStreamingClient(),
+		ServerStreams: method.IsStreamingServer(),
+	}
+	streaming := desc.ClientStreams || desc.ServerStreams
+	input, output := messageType(method.Input()), messageType(method.Output())
+	newInput := func() proto.Message { return input.New().Interface() }
+
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		inbound, outbound := runtime.MarshalerForRequest(mux, r)
+		c, ok := detect(r)
+		if !ok {
+			runtime.HTTPError(r.Context(), mux, outbound, w, r,
+				status.Error(codes.InvalidArgument, "content type must be a gRPC-Web or Connect type"))
+			return
+		}
+		// Neither Connect nor gRPC-Web JSON types are registered on the mux,
+		// so this is its default JSON marshaler.
+		c.jsonCodec = inbound
+
+		res := c.responder(w)
+		switch {
+		case c.compressed(r):
+			res.finish(status.New(codes.Unimplemented, "compressed requests are not supported"), nil)
+			return
+		case c.protocol == connectUnary && streaming:
+			res.finish(status.New(codes.InvalidArgument, "streaming methods need a Connect streaming content type"), nil)
+			return
+		case c.protocol == connectStream && !streaming:
+			res.finish(status.New(codes.InvalidArgument, "unary methods need a Connect unary content type"), nil)
+			return
+		}
+
+		// AnnotateContext adds the metadata set with runtime.WithMetadata,
+		// including the internal identity, and honors Grpc-Timeout.
+		ctx, err := runtime.AnnotateContext(r.Context(), mux, r, path, runtime.WithHTTPPathPattern(path))
+		if err != nil {
+			res.finish(status.Convert(err), nil)
+			return
+		}
+		if timeout, ok := connectTimeout(r); ok && c.protocol != grpcWeb && c.protocol != grpcWebText {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		stream, err := conn.NewStream(ctx, desc, path)
+		if err != nil {
+			res.finish(clientStatus(err), nil)
+			return
+		}
+
+		sent := 0
+		err = c.readMessages(c.body(r), newInput, func(m proto.Message) error {
+			if sent++; sent > 1 && !desc.ClientStreams {
+				return status.Error(codes.InvalidArgument, "expected a single request message")
+			}
+			return stream.SendMsg(m)
+		})
+		if err == nil && sent == 0 && !desc.ClientStreams {
+			err = status.Error(codes.InvalidArgument, "missing request message")
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			// The upstream already ended the call; RecvMsg returns why.
+		case err != nil:
+			res.finish(status.Convert(err), nil)
+			return
+		default:
+			stream.CloseSend()
+		}
+
+		if desc.ServerStreams {
+			// Streams outlive the server write timeout; the route timeout
+			// bounds them instead.
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		}
+		if header, err := stream.Header(); err == nil {
+			res.header(header)
+		}
+		for {
+			out := output.New().Interface()
+			err := stream.RecvMsg(out)
+			if errors.Is(err, io.EOF) {
+				res.finish(status.New(codes.OK, ""), stream.Trailer())
+				return
+			}
+			if err != nil {
+				res.finish(clientStatus(err), stream.Trailer())
+				return
+			}
+
+			data, err := c.marshal(out)
+			if err != nil {
+				res.finish(status.New(codes.Internal, "could not encode response message"), nil)
+				return
+			}
+			if err := res.message(data); err != nil {
+				// The client is gone; returning cancels the call.
+				return
+			}
+		}
+	}
+}
+
+// messageType prefers the generated type of desc, linked in through the
+// service registrations, and falls back to a dynamic one.
+func messageType(desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil {
+		return mt
+	}
+	return dynamicpb.NewMessageType(desc)
+}
+
+// connectTimeout reads Connect-Timeout-Ms, at most 10 digits.
+func connectTimeout(r *http.Request) (time.Duration, bool) {
+	value := r.Header.Get("Connect-Timeout-Ms")
+	if value == "" || len(value) > 10 {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// clientStatus is the status of a failed upstream call as clients see it;
+// internal errors keep their details but not their message.
+func clientStatus(err error) *status.Status {
+	st := status.Convert(err)
+	if st.Code() != codes.Internal && st.Code() != codes.Unknown {
+		return st
+	}
+	p := st.Proto()
+	p.Message = http.StatusText(http.StatusInternalServerError)
+	return status.FromProto(p)
+}
@@ -0,0 +1,496 @@
+package webrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"ms-ride-sharing/shared/logger"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type protocol int
+
+const (
+	grpcWeb protocol = iota + 1
+	grpcWebText
+	connectUnary
+	connectStream
+)
+
+const (
+	// Envelope flags. Bit 0 marks a compressed message in every protocol.
+	flagCompressed      = 0x01
+	flagConnectEndOfRPC = 0x02
+	flagGRPCWebTrailer  = 0x80
+
+	envelopeHeaderSize = 5
+)
+
+// call is how a request is encoded and how its response must be.
+type call struct {
+	protocol    protocol
+	json        bool
+	contentType string
+	// jsonCodec is the JSON marshaler of the gateway mux, so JSON calls
+	// follow the same unknown field rules as the REST routes.
+	jsonCodec runtime.Marshaler
+}
+
+// detect reads the protocol of r from its Content-Type. Connect unary calls
+// use the plain application/proto and application/json types, so they must
+// also carry the Connect-Protocol-Version header to tell them from REST.
+func detect(r *http.Request) (call, bool) {
+	if r.Method != http.MethodPost {
+		return call{}, false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/grpc-web", "application/grpc-web+proto":
+		return call{protocol: grpcWeb, contentType: "application/grpc-web+proto"}, true
+	case "application/grpc-web+json":
+		return call{protocol: grpcWeb, json: true, contentType: mediaType}, true
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		return call{protocol: grpcWebText, contentType: "application/grpc-web-text+proto"}, true
+	case "application/connect+proto":
+		return call{protocol: connectStream, contentType: mediaType}, true
+	case "application/connect+json":
+		return call{protocol: connectStream, json: true, contentType: mediaType}, true
+	case "application/proto", "application/json":
+		if r.Header.Get("Connect-Protocol-Version") != "1" {
+			return call{}, false
+		}
+		return call{protocol: connectUnary, json: mediaType == "application/json", contentType: mediaType}, true
+	}
+	return call{}, false
+}
+
+// IsRequest reports whether r is a gRPC-Web or Connect call, whose errors
+// must be written with WriteError rather than as problem+json.
+func IsRequest(r *http.Request) bool {
+	_, ok := detect(r)
+	return ok
+}
+
+// WriteError answers a call for which IsRequest holds with st. Headers
+// already set on w, such as Retry-After, are sent along.
+func WriteError(w http.ResponseWriter, r *http.Request, st *status.Status) {
+	c, _ := detect(r)
+	c.responder(w).finish(st, nil)
+}
+
+func (c call) unmarshal(data []byte, m proto.Message) error {
+	if c.json {
+		return c.jsonCodec.Unmarshal(data, m)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (c call) marshal(m proto.Message) ([]byte, error) {
+	if c.json {
+		return c.jsonCodec.Marshal(m)
+	}
+	return proto.Marshal(m)
+}
+
+// compressed reports whether the client compressed the request, which the
+// gateway does not support and does not advertise.
+func (c call) compressed(r *http.Request) bool {
+	var encoding string
+	switch c.protocol {
+	case grpcWeb, grpcWebText:
+		encoding = r.Header.Get("Grpc-Encoding")
+	case connectUnary:
+		encoding = r.Header.Get("Content-Encoding")
+	case connectStream:
+		encoding = r.Header.Get("Connect-Content-Encoding")
+	}
+	return encoding != "" && encoding != "identity"
+}
+
+// body returns the request body with any transport encoding removed.
+func (c call) body(r *http.Request) io.Reader {
+	if c.protocol == grpcWebText {
+		return base64.NewDecoder(base64.StdEncoding, r.Body)
+	}
+	return r.Body
+}
+
+// readMessages decodes the request messages of body and passes each to send.
+// Connect unary bodies are a single bare message; the other protocols frame
+// every message in an envelope.
+func (c call) readMessages(body io.Reader, newMessage func() proto.Message, send func(proto.Message) error) error {
+	if c.protocol == connectUnary {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return bodyError(err)
+		}
+		return c.decode(data, newMessage, send)
+	}
+
+	for {
+		flags, data, err := readEnvelope(body)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return bodyError(err)
+		}
+		if flags&flagCompressed != 0 {
+			return status.Error(codes.Unimplemented, "compressed messages are not supported")
+		}
+		if flags != 0 {
+			return status.Errorf(codes.InvalidArgument, "unexpected envelope flags %#x", flags)
+		}
+		if err := c.decode(data, newMessage, send); err != nil {
+			return err
+		}
+	}
+}
+
+func (c call) decode(data []byte, newMessage func() proto.Message, send func(proto.Message) error) error {
+	m := newMessage()
+	if err := c.unmarshal(data, m); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid request message: %v", err)
+	}
+	return send(m)
+}
+
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return status.Error(codes.ResourceExhausted, "request body too large")
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return status.Error(codes.InvalidArgument, "truncated request message")
+	}
+	return status.Errorf(codes.InvalidArgument, "could not read request body: %v", err)
+}
+
+func readEnvelope(r io.Reader) (byte, []byte, error) {
+	var header [envelopeHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[1:]))
+
+	// Read through a limit rather than allocating size up front: the body
+	// size limit of the route bounds what a client can make us buffer.
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return 0, nil, err
+	}
+	if int64(len(data)) != size {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return header[0], data, nil
+}
+
+func envelope(flags byte, data []byte) []byte {
+	buf := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(data))
+	buf[0] = flags
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(data)))
+	return append(buf, data...)
+}
+
+// responder writes a call's response in its protocol. header is called at
+// most once, before the first message; finish always ends the response.
+type responder interface {
+	header(md metadata.MD)
+	message(data []byte) error
+	finish(st *status.Status, trailer metadata.MD)
+}
+
+func (c call) responder(w http.ResponseWriter) responder {
+	switch c.protocol {
+	case connectUnary:
+		return &connectUnaryResponder{w: w, contentType: c.contentType}
+	case connectStream:
+		return &connectStreamResponder{w: w, contentType: c.contentType}
+	default:
+		return &grpcWebResponder{w: w, contentType: c.contentType, text: c.protocol == grpcWebText}
+	}
+}
+
+// grpcWebResponder always answers 200 and reports the status in a trailer
+// frame at the end of the body.
+type grpcWebResponder struct {
+	w           http.ResponseWriter
+	contentType string
+	text        bool
+	started     bool
+}
+
+func (g *grpcWebResponder) header(md metadata.MD) {
+	g.started = true
+	setHeaders(g.w.Header(), md, "")
+	g.w.Header().Set("Content-Type", g.contentType)
+	g.w.WriteHeader(http.StatusOK)
+}
+
+func (g *grpcWebResponder) message(data []byte) error {
+	return g.write(envelope(0, data))
+}
+
+func (g *grpcWebResponder) finish(st *status.Status, trailer metadata.MD) {
+	if !g.started {
+		g.header(nil)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "grpc-status: %d\r\n", st.Code())
+	if msg := st.Message(); msg != "" {
+		fmt.Fprintf(&buf, "grpc-message: %s\r\n", percentEncode(msg))
+	}
+	if len(st.Proto().GetDetails()) > 0 {
+		if details, err := proto.Marshal(st.Proto()); err == nil {
+			fmt.Fprintf(&buf, "grpc-status-details-bin: %s\r\n", base64.RawStdEncoding.EncodeToString(details))
+		}
+	}
+	for _, key := range sortedKeys(trailer) {
+		for _, value := range headerValues(key, trailer[key]) {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+	}
+
+	if err := g.write(envelope(flagGRPCWebTrailer, buf.Bytes())); err != nil {
+		slog.Debug("error writing grpc-web trailers", logger.Err(err))
+	}
+}
+
+func (g *grpcWebResponder) write(frame []byte) error {
+	if g.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+	if _, err := g.w.Write(frame); err != nil {
+		return err
+	}
+	return http.NewResponseController(g.w).Flush()
+}
+
+// connectUnaryResponder buffers the single response message, since an error
+// after it must still change the HTTP status.
+type connectUnaryResponder struct {
+	w           http.ResponseWriter
+	contentType string
+	md          metadata.MD
+	body        []byte
+}
+
+func (c *connectUnaryResponder) header(md metadata.MD) { c.md = md }
+
+func (c *connectUnaryResponder) message(data []byte) error {
+	c.body = data
+	return nil
+}
+
+func (c *connectUnaryResponder) finish(st *status.Status, trailer metadata.MD) {
+	header := c.w.Header()
+	setHeaders(header, c.md, "")
+	setHeaders(header, trailer, "Trailer-")
+
+	if st.Code() == codes.OK {
+		header.Set("Content-Type", c.contentType)
+		c.w.WriteHeader(http.StatusOK)
+		c.w.Write(c.body)
+		return
+	}
+
+	header.Set("Content-Type", "application/json")
+	c.w.WriteHeader(connectHTTPStatus(st.Code()))
+	if err := json.NewEncoder(c.w).Encode(newConnectError(st)); err != nil {
+		slog.Debug("error writing connect error", logger.Err(err))
+	}
+}
+
+// connectStreamResponder answers 200 and ends the body with an end-of-RPC
+// envelope holding the error, if any, and the trailers.
+type connectStreamResponder struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (c *connectStreamResponder) header(md metadata.MD) {
+	c.started = true
+	setHeaders(c.w.Header(), md, "")
+	c.w.Header().Set("Content-Type", c.contentType)
+	c.w.WriteHeader(http.StatusOK)
+}
+
+func (c *connectStreamResponder) message(data []byte) error {
+	return c.write(envelope(0, data))
+}
+
+func (c *connectStreamResponder) finish(st *status.Status, trailer metadata.MD) {
+	if !c.started {
+		c.header(nil)
+	}
+
+	var end struct {
+		Error    *connectError       `json:"error,omitempty"`
+		Metadata map[string][]string `json:"metadata,omitempty"`
+	}
+	if st.Code() != codes.OK {
+		end.Error = newConnectError(st)
+	}
+	for _, key := range sortedKeys(trailer) {
+		if end.Metadata == nil {
+			end.Metadata = map[string][]string{}
+		}
+		end.Metadata[key] = headerValues(key, trailer[key])
+	}
+
+	data, err := json.Marshal(end)
+	if err != nil {
+		slog.Error("error encoding connect end of stream", logger.Err(err))
+		return
+	}
+	if err := c.write(envelope(flagConnectEndOfRPC, data)); err != nil {
+		slog.Debug("error writing connect end of stream", logger.Err(err))
+	}
+}
+
+func (c *connectStreamResponder) write(frame []byte) error {
+	if _, err := c.w.Write(frame); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
+type connectError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Details []connectDetail `json:"details,omitempty"`
+}
+
+type connectDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func newConnectError(st *status.Status) *connectError {
+	e := &connectError{Code: connectCodes[st.Code()], Message: st.Message()}
+	if e.Code == "" {
+		e.Code = connectCodes[codes.Unknown]
+	}
+	for _, detail := range st.Proto().GetDetails() {
+		typeURL := detail.GetTypeUrl()
+		e.Details = append(e.Details, connectDetail{
+			Type:  typeURL[strings.LastIndex(typeURL, "/")+1:],
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		})
+	}
+	return e
+}
+
+var connectCodes = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "data_loss",
+	codes.Unauthenticated:    "unauthenticated",
+}
+
+// connectHTTPStatus is the HTTP status of a failed Connect unary call, as
+// set by the Connect protocol.
+func connectHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// setHeaders copies the metadata an upstream sent to header, leaving out
+// pseudo headers and the ones the protocol sets itself.
+func setHeaders(header http.Header, md metadata.MD, prefix string) {
+	for _, key := range sortedKeys(md) {
+		for _, value := range headerValues(key, md[key]) {
+			header.Add(prefix+key, value)
+		}
+	}
+}
+
+func sortedKeys(md metadata.MD) []string {
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || key == "content-type" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// headerValues encodes binary metadata, whose keys end in -bin, as base64.
+func headerValues(key string, values []string) []string {
+	if !strings.HasSuffix(key, "-bin") {
+		return values
+	}
+	encoded := make([]string, len(values))
+	for i, value := range values {
+		encoded[i] = base64.RawStdEncoding.EncodeToString([]byte(value))
+	}
+	return encoded
+}
+
+// percentEncode escapes grpc-message as the gRPC spec requires.
+func percentEncode(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
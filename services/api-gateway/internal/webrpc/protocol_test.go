@@ -0,0 +1,288 @@
+package webrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags byte
+		data  []byte
+	}{
+		{name: "empty message", flags: 0, data: nil},
+		{name: "message", flags: 0, data: []byte("hello")},
+		{name: "grpc-web trailer", flags: flagGRPCWebTrailer, data: []byte("grpc-status: 0\r\n")},
+		{name: "connect end of rpc", flags: flagConnectEndOfRPC, data: []byte("{}")},
+		{name: "large message", flags: 0, data: bytes.Repeat([]byte{0xff}, 70000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := envelope(tt.flags, tt.data)
+			if len(frame) != envelopeHeaderSize+len(tt.data) {
+				t.Fatalf("frame length = %d, want %d", len(frame), envelopeHeaderSize+len(tt.data))
+			}
+
+			r := bytes.NewReader(frame)
+			flags, data, err := readEnvelope(r)
+			if err != nil {
+				t.Fatalf("readEnvelope: %v", err)
+			}
+			if flags != tt.flags {
+				t.Errorf("flags = %#x, want %#x", flags, tt.flags)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("data = %q, want %q", data, tt.data)
+			}
+			if _, _, err := readEnvelope(r); !errors.Is(err, io.EOF) {
+				t.Errorf("second readEnvelope error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReadEnvelopeErrors(t *testing.T) {
+	frame := envelope(0, []byte("hello"))
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{name: "no frame", input: nil, want: io.EOF},
+		{name: "truncated header", input: frame[:3], want: io.ErrUnexpectedEOF},
+		{name: "truncated message", input: frame[:len(frame)-1], want: io.ErrUnexpectedEOF},
+		{name: "length past the body", input: []byte{0, 0xff, 0xff, 0xff, 0xff, 'x'}, want: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readEnvelope(bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCWebResponderFinish(t *testing.T) {
+	withDetails, err := status.New(codes.InvalidArgument, "bad").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "email", Description: "invalid"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	detailsBin, err := proto.Marshal(withDetails.Proto())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		text     bool
+		messages []string
+		status   *status.Status
+		trailer  metadata.MD
+		want     []string
+	}{
+		{
+			name:   "ok",
+			status: status.New(codes.OK, ""),
+			want:   []string{"grpc-status: 0\r\n"},
+		},
+		{
+			name:     "messages then ok",
+			messages: []string{"one", "two"},
+			status:   status.New(codes.OK, ""),
+			want:     []string{"one", "two", "grpc-status: 0\r\n"},
+		},
+		{
+			name:   "message is percent encoded",
+			status: status.New(codes.NotFound, "user 100% não encontrado\n"),
+			want:   []string{"grpc-status: 5\r\ngrpc-message: user 100%25 n%C3%A3o encontrado%0A\r\n"},
+		},
+		{
+			name:   "details",
+			status: withDetails,
+			want: []string{"grpc-status: 3\r\ngrpc-message: bad\r\ngrpc-status-details-bin: " +
+				base64.RawStdEncoding.EncodeToString(detailsBin) + "\r\n"},
+		},
+		{
+			name:   "trailers are sorted and binary ones encoded",
+			status: status.New(codes.OK, ""),
+			trailer: metadata.MD{
+				"x-b":         {"2"},
+				"x-a":         {"1", "3"},
+				"x-trace-bin": {"\x00\x01"},
+				"grpc-status": {"0"},
+			},
+			want: []string{"grpc-status: 0\r\nx-a: 1\r\nx-a: 3\r\nx-b: 2\r\nx-trace-bin: AAE\r\n"},
+		},
+		{
+			name:     "text mode",
+			text:     true,
+			messages: []string{"one"},
+			status:   status.New(codes.Unavailable, "down"),
+			want:     []string{"one", "grpc-status: 14\r\ngrpc-message: down\r\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			contentType := "application/grpc-web+proto"
+			if tt.text {
+				contentType = "application/grpc-web-text+proto"
+			}
+			res := &grpcWebResponder{w: rec, contentType: contentType, text: tt.text}
+			for _, m := range tt.messages {
+				if err := res.message([]byte(m)); err != nil {
+					t.Fatalf("message: %v", err)
+				}
+			}
+			res.finish(tt.status, tt.trailer)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != contentType {
+				t.Errorf("Content-Type = %q, want %q", got, contentType)
+			}
+
+			body := rec.Body.Bytes()
+			if tt.text {
+				// Every frame is encoded on its own, padding included.
+				var decoded []byte
+				for _, chunk := range splitBase64(t, string(body)) {
+					decoded = append(decoded, chunk...)
+				}
+				body = decoded
+			}
+
+			r := bytes.NewReader(body)
+			for i, want := range tt.want {
+				flags, data, err := readEnvelope(r)
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+				wantFlags := byte(0)
+				if i == len(tt.want)-1 {
+					wantFlags = flagGRPCWebTrailer
+				}
+				if flags != wantFlags {
+					t.Errorf("frame %d flags = %#x, want %#x", i, flags, wantFlags)
+				}
+				if string(data) != want {
+					t.Errorf("frame %d = %q, want %q", i, data, want)
+				}
+			}
+			if r.Len() != 0 {
+				t.Errorf("%d bytes after the trailer frame", r.Len())
+			}
+		})
+	}
+}
+
+// splitBase64 decodes a concatenation of padded base64 strings.
+func splitBase64(t *testing.T, s string) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	for s != "" {
+		end := strings.Index(s, "=")
+		switch {
+		case end < 0:
+			end = len(s)
+		default:
+			for end < len(s) && s[end] == '=' {
+				end++
+			}
+		}
+		chunk, err := base64.StdEncoding.DecodeString(s[:end])
+		if err != nil {
+			t.Fatalf("decoding %q: %v", s[:end], err)
+		}
+		chunks = append(chunks, chunk)
+		s = s[end:]
+	}
+	return chunks
+}
+
+func TestConnectHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.Canceled, 499},
+		{codes.Unknown, http.StatusInternalServerError},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.FailedPrecondition, http.StatusBadRequest},
+		{codes.Aborted, http.StatusConflict},
+		{codes.OutOfRange, http.StatusBadRequest},
+		{codes.Unimplemented, http.StatusNotImplemented},
+		{codes.Internal, http.StatusInternalServerError},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+		{codes.DataLoss, http.StatusInternalServerError},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			if got := connectHTTPStatus(tt.code); got != tt.want {
+				t.Errorf("connectHTTPStatus(%s) = %d, want %d", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		connect     string
+		want        call
+		ok          bool
+	}{
+		{name: "grpc-web", contentType: "application/grpc-web", want: call{protocol: grpcWeb, contentType: "application/grpc-web+proto"}, ok: true},
+		{name: "grpc-web json", contentType: "application/grpc-web+json", want: call{protocol: grpcWeb, json: true, contentType: "application/grpc-web+json"}, ok: true},
+		{name: "grpc-web text", contentType: "application/grpc-web-text", want: call{protocol: grpcWebText, contentType: "application/grpc-web-text+proto"}, ok: true},
+		{name: "connect stream", contentType: "application/connect+proto", want: call{protocol: connectStream, contentType: "application/connect+proto"}, ok: true},
+		{name: "connect unary json", contentType: "application/json; charset=utf-8", connect: "1", want: call{protocol: connectUnary, json: true, contentType: "application/json"}, ok: true},
+		{name: "connect unary proto", contentType: "application/proto", connect: "1", want: call{protocol: connectUnary, contentType: "application/proto"}, ok: true},
+		{name: "plain json is rest", contentType: "application/json"},
+		{name: "get", method: http.MethodGet, contentType: "application/grpc-web"},
+		{name: "unknown type", contentType: "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r := httptest.NewRequest(method, "/ridesharing.v1.UserService/Login", nil)
+			r.Header.Set("Content-Type", tt.contentType)
+			if tt.connect != "" {
+				r.Header.Set("Connect-Protocol-Version", tt.connect)
+			}
+
+			got, ok := detect(r)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("detect = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
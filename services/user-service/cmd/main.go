@@ -3,52 +3,164 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"ms-ride-sharing/services/user-service/internal/config"
 	"ms-ride-sharing/services/user-service/internal/handlers"
+	usermetrics "ms-ride-sharing/services/user-service/internal/metrics"
 	"ms-ride-sharing/services/user-service/internal/repository"
 	"ms-ride-sharing/services/user-service/internal/service"
+	"ms-ride-sharing/shared/admin"
+	"ms-ride-sharing/shared/authz"
+	"ms-ride-sharing/shared/grpcx"
+	"ms-ride-sharing/shared/health"
 	"ms-ride-sharing/shared/jwt"
+	"ms-ride-sharing/shared/logger"
+	"ms-ride-sharing/shared/metrics"
+	"ms-ride-sharing/shared/mtls"
+	userpb "ms-ride-sharing/shared/proto/v1/user"
+	"ms-ride-sharing/shared/runtimeconfig"
+	"ms-ride-sharing/shared/tracing"
+	"ms-ride-sharing/shared/types"
 	"net"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	grpcserver "google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 func main() {
 	configData := config.LoadConfig()
-	log.Printf("starting user service on %s environment", configData.Environment)
+	logger.Setup("user-service", configData.Environment)
+	slog.Info("starting user service")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), configData.Tracing())
+	if err != nil {
+		logger.Fatal("failed to set up tracing", logger.Err(err))
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("error flushing traces", logger.Err(err))
+		}
+	}()
 
 	db := config.InitDB(configData)
 	userRepo := repository.NewUserRepository(db)
 	rdbRepo := redis.NewClient(&redis.Options{
 		Addr: fmt.Sprintf("%s:%s", configData.RedisHost, configData.RedisPort),
 	})
+	// Statements are left out of spans since they carry session tokens.
+	if err := redisotel.InstrumentTracing(rdbRepo, redisotel.WithDBStatement(false)); err != nil {
+		logger.Fatal("failed to instrument redis", logger.Err(err))
+	}
+
+	if err := metrics.RegisterDBPool("user_service", db); err != nil {
+		logger.Fatal("failed to register database metrics", logger.Err(err))
+	}
+	if err := metrics.RegisterRedisPool("user_service", rdbRepo); err != nil {
+		logger.Fatal("failed to register redis metrics", logger.Err(err))
+	}
+	if err := usermetrics.RegisterActiveSessions(rdbRepo, 30*time.Second); err != nil {
+		logger.Fatal("failed to register session metrics", logger.Err(err))
+	}
 
 	defer func() {
 		if err := rdbRepo.Close(); err != nil {
-			log.Printf("error while closing redis connection: %v", err)
+			slog.Error("error while closing redis connection", logger.Err(err))
 		}
 	}()
 
+	runtimeCfg, err := runtimeconfig.New(configData.RuntimeConfigPath, config.DefaultRuntime())
+	if err != nil {
+		logger.Fatal("failed to load runtime config", logger.Err(err))
+	}
+
 	jwtSvc := jwt.NewJWTService(configData.JWTSecret)
-	userSvc := service.NewUserService(userRepo, jwtSvc, rdbRepo)
+	subscribeRuntime(runtimeCfg, jwtSvc)
+
+	userSvc := service.NewUserService(userRepo, jwtSvc, rdbRepo, configData.WSTicketTTL)
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", configData.Port))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logger.Fatal("failed to listen", logger.Err(err))
+	}
+
+	registry := authz.NewRegistry(userpb.File_user_user_proto)
+	if err := registry.Validate(types.Roles()); err != nil {
+		logger.Fatal("invalid auth rules", logger.Err(err))
+	}
+
+	serverOpts := []grpcserver.ServerOption{
+		grpcserver.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)),
 	}
+	serverOpts = append(serverOpts, metrics.GRPCServerOptions()...)
+	serverOpts = append(serverOpts,
+		grpcx.ServerOptions(
+			grpcx.WithDefaultTimeout(configData.GRPCDefaultTimeout),
+			grpcx.WithMaxTimeout(configData.GRPCMaxTimeout),
+			grpcx.WithErrorDomain(handlers.ErrorDomain),
+			grpcx.WithErrorMappings(handlers.ErrorMappings...),
+			grpcx.WithAuthorization(registry, authz.NewVerifier(configData.InternalTokenSecret)),
+		)...,
+	)
 
-	grpcServer := grpcserver.NewServer()
+	var certs *mtls.Source
+	if configData.TLS().Enabled() {
+		certs, err = mtls.NewSource(configData.TLS())
+		if err != nil {
+			logger.Fatal("failed to load tls certificates", logger.Err(err))
+		}
+		serverOpts = append(serverOpts, grpcserver.Creds(certs.ServerCredentials(configData.TLSAllowedPeers)))
+	} else {
+		slog.Warn("gRPC listener is not using TLS")
+	}
+
+	grpcServer := grpcserver.NewServer(serverOpts...)
 	handlers.NewGRPCHandler(grpcServer, userSvc, jwtSvc)
 
+	healthSrv := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthSrv)
+
+	if configData.GRPCReflection {
+		slog.Info("gRPC server reflection enabled")
+		reflection.Register(grpcServer)
+	}
+
+	healthMonitor := health.NewMonitor(
+		configData.HealthCheckInterval,
+		config.DBHealthCheck(db),
+		health.RedisCheck(rdbRepo),
+	)
+	health.BindGRPC(healthMonitor, healthSrv, userpb.UserService_ServiceDesc.ServiceName)
+
 	// gracefull shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	go healthMonitor.Run(ctx)
+
+	go runtimeCfg.Watch(ctx, configData.RuntimeReloadInterval)
+	if certs != nil {
+		go certs.Watch(ctx, configData.TLSReloadInterval)
+	}
+
+	adminServer := admin.NewServer(fmt.Sprintf(":%s", configData.AdminPort))
+	adminServer.Handle("/admin/config", runtimeCfg.Handler())
+	adminServer.Handle("/metrics", metrics.Handler())
+	adminServer.Start()
+
 	go func() {
 		signCh := make(chan os.Signal, 1)
 		signal.Notify(signCh, os.Interrupt, syscall.SIGTERM)
@@ -57,15 +169,76 @@ func main() {
 	}()
 
 	go func() {
-		log.Printf("starting gRPC user service on port %s", lis.Addr().String())
+		slog.Info("starting gRPC user service", slog.String("addr", lis.Addr().String()))
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Printf("failed to serve: %v", err)
+			slog.Error("failed to serve", logger.Err(err))
 			cancel()
 		}
 	}()
 
+	var probeServer *grpcserver.Server
+	if configData.GRPCHealthPort != "" {
+		probeLis, err := net.Listen("tcp", fmt.Sprintf(":%s", configData.GRPCHealthPort))
+		if err != nil {
+			logger.Fatal("failed to listen for health probes", logger.Err(err))
+		}
+		probeServer = grpcserver.NewServer()
+		healthpb.RegisterHealthServer(probeServer, healthSrv)
+		go func() {
+			slog.Info("starting gRPC health probe listener", slog.String("addr", probeLis.Addr().String()))
+			if err := probeServer.Serve(probeLis); err != nil {
+				slog.Error("failed to serve health probes", logger.Err(err))
+			}
+		}()
+	}
+
 	// wait for the shutdown signal
 	<-ctx.Done()
-	log.Println("shutting down the server...")
-	grpcServer.GracefulStop()
+	slog.Info("shutting down the server")
+
+	// Report NOT_SERVING and keep serving for a while so the readiness probe
+	// fails and Kubernetes stops routing new calls before we stop accepting them.
+	healthSrv.Shutdown()
+	slog.Info("draining connections", slog.Duration("timeout", configData.DrainTimeout))
+	time.Sleep(configData.DrainTimeout)
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		slog.Warn("graceful stop timed out, forcing shutdown")
+		grpcServer.Stop()
+	}
+
+	if probeServer != nil {
+		probeServer.Stop()
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("could not stop admin server gracefully", logger.Err(err))
+	}
+}
+
+func subscribeRuntime(store *runtimeconfig.Store[config.Runtime], jwtSvc *jwt.JWTService) {
+	err := store.Subscribe(func(_, next *config.Runtime) error {
+		jwtSvc.SetExpirations(next.AccessTokenTTL, next.RefreshTokenTTL)
+		return nil
+	}, "access_token_ttl", "refresh_token_ttl")
+	if err != nil {
+		logger.Fatal("failed to apply token lifetimes", logger.Err(err))
+	}
+
+	err = store.Subscribe(func(_, next *config.Runtime) error {
+		return logger.SetLevel(next.LogLevel)
+	}, "log_level")
+	if err != nil {
+		logger.Fatal("failed to apply log level", logger.Err(err))
+	}
 }
@@ -1,31 +1,100 @@
 package config
 
-import "ms-ride-sharing/shared/env"
+import (
+	"fmt"
+	"ms-ride-sharing/shared/env"
+	"ms-ride-sharing/shared/mtls"
+	"ms-ride-sharing/shared/tracing"
+	"time"
+)
 
 type Config struct {
-	Environment      string
-	Port             string
-	JWTSecret        string
-	PostgresUser     string
-	PostgresPassword string
-	PostgresHost     string
-	PostgresPort     string
-	PostgresDB       string
-	RedisHost        string
-	RedisPort        string
+	Environment      string `env:"ENVIRONMENT" default:"development"`
+	Port             string `env:"USER_SERVICE_PORT" default:"9091"`
+	JWTSecret        string `env:"JWT_SECRET" default:"um-secret-mto-dificil" secret:"true"`
+	PostgresUser     string `env:"POSTGRES_USER" default:"user"`
+	PostgresPassword string `env:"POSTGRES_PASSWORD" default:"password" secret:"true"`
+	PostgresHost     string `env:"POSTGRES_HOST" default:"user-service-db"`
+	PostgresPort     string `env:"POSTGRES_PORT" default:"5432"`
+	PostgresDB       string `env:"POSTGRES_DB" default:"postgres"`
+	PostgresSSLMode  string `env:"POSTGRES_SSLMODE" default:"disable"`
+	RedisHost        string `env:"REDIS_HOST" default:"localhost"`
+	RedisPort        string `env:"REDIS_PORT" default:"6379"`
+	AdminPort        string `env:"ADMIN_PORT" default:"9092"`
+
+	// InternalTokenSecret verifies the identity the gateway signs for each
+	// call; it must match the gateway and differ from JWT_SECRET.
+	InternalTokenSecret string `env:"INTERNAL_TOKEN_SECRET" default:"segredo-interno-dev" secret:"true"`
+
+	// WSTicketTTL is how long a WebSocket ticket can wait to be redeemed. It
+	// only needs to cover the client opening the connection.
+	WSTicketTTL time.Duration `env:"WS_TICKET_TTL" default:"30s"`
+
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" default:"5s"`
+	DrainTimeout        time.Duration `env:"DRAIN_TIMEOUT" default:"5s"`
+	GRPCReflection      bool          `env:"GRPC_REFLECTION" default:"false"`
+	GRPCDefaultTimeout  time.Duration `env:"GRPC_DEFAULT_TIMEOUT" default:"10s"`
+	GRPCMaxTimeout      time.Duration `env:"GRPC_MAX_TIMEOUT" default:"30s"`
+	// GRPCHealthPort serves only the gRPC health service in plaintext, for
+	// kubelet probes that cannot speak mTLS. Empty disables it.
+	GRPCHealthPort string `env:"GRPC_HEALTH_PORT"`
+
+	TLSCertFile       string        `env:"GRPC_TLS_CERT_FILE"`
+	TLSKeyFile        string        `env:"GRPC_TLS_KEY_FILE"`
+	TLSCAFile         string        `env:"GRPC_TLS_CA_FILE"`
+	TLSAllowedPeers   []string      `env:"GRPC_TLS_ALLOWED_PEERS"`
+	TLSReloadInterval time.Duration `env:"GRPC_TLS_RELOAD_INTERVAL" default:"1m"`
+
+	TracingExporter    string  `env:"TRACING_EXPORTER" default:"none"`
+	OTLPEndpoint       string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" default:"otel-collector:4317"`
+	OTLPInsecure       bool    `env:"OTEL_EXPORTER_OTLP_INSECURE" default:"true"`
+	TracingFile        string  `env:"TRACING_FILE" default:"traces.json"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1"`
+
+	RuntimeConfigPath     string        `env:"RUNTIME_CONFIG_PATH"`
+	RuntimeReloadInterval time.Duration `env:"RUNTIME_CONFIG_RELOAD_INTERVAL" default:"10s"`
+}
+
+func (c *Config) Tracing() tracing.Config {
+	return tracing.Config{
+		ServiceName:  "user-service",
+		Environment:  c.Environment,
+		Exporter:     c.TracingExporter,
+		OTLPEndpoint: c.OTLPEndpoint,
+		OTLPInsecure: c.OTLPInsecure,
+		FilePath:     c.TracingFile,
+		SampleRatio:  c.TracingSampleRatio,
+	}
+}
+
+func (c *Config) TLS() mtls.Config {
+	return mtls.Config{
+		CertFile: c.TLSCertFile,
+		KeyFile:  c.TLSKeyFile,
+		CAFile:   c.TLSCAFile,
+	}
 }
 
 func LoadConfig() *Config {
-	return &Config{
-		Environment:      env.GetString("ENVIRONMENT", "development"),
-		Port:             env.GetString("USER_SERVICE_PORT", "9091"),
-		JWTSecret:        env.GetString("JWT_SECRET", "um-secret-mto-dificil"),
-		PostgresUser:     env.GetString("POSTGRES_USER", "user"),
-		PostgresPassword: env.GetString("POSTGRES_PASSWORD", "password"),
-		PostgresHost:     env.GetString("POSTGRES_HOST", "user-service-db"),
-		PostgresPort:     env.GetString("POSTGRES_PORT", "5432"),
-		PostgresDB:       env.GetString("POSTGRES_DB", "postgres"),
-		RedisHost:        env.GetString("REDIS_HOST", "localhost"),
-		RedisPort:        env.GetString("REDIS_PORT", "6379"),
+	config := &Config{}
+	env.MustLoad(config, env.WithFile(env.GetString("CONFIG_FILE", "")))
+	return config
+}
+
+func (c *Config) Validate() error {
+	if c.Environment == env.Production && c.PostgresSSLMode == "disable" {
+		return fmt.Errorf("POSTGRES_SSLMODE: sslmode=disable is not allowed in production")
+	}
+	if err := c.TLS().Validate(); err != nil {
+		return fmt.Errorf("GRPC_TLS: %w", err)
+	}
+	if c.Environment == env.Production && !c.TLS().Enabled() {
+		return fmt.Errorf("GRPC_TLS_CERT_FILE: a plaintext gRPC listener is not allowed in production")
+	}
+	// The CA signs every service's certificate; without an allow list any of
+	// them could call this one.
+	if c.Environment == env.Production && len(c.TLSAllowedPeers) == 0 {
+		return fmt.Errorf("GRPC_TLS_ALLOWED_PEERS: at least one peer is required in production")
 	}
+	return nil
 }
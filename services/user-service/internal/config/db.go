@@ -1,36 +1,73 @@
 package config
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"ms-ride-sharing/services/user-service/internal/models"
+	"ms-ride-sharing/shared/health"
+	"ms-ride-sharing/shared/logger"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
 func InitDB(config *Config) *gorm.DB {
 	POSTGRES_DSN := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		config.PostgresHost,
 		config.PostgresPort,
 		config.PostgresUser,
 		config.PostgresPassword,
 		config.PostgresDB,
+		config.PostgresSSLMode,
 	)
 
-	db, err := gorm.Open(postgres.Open(POSTGRES_DSN), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(POSTGRES_DSN), &gorm.Config{
+		// Parameterized queries keep emails and password hashes out of the logs.
+		Logger: gormlogger.NewSlogLogger(slog.Default(), gormlogger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  gormlogger.Warn,
+			ParameterizedQueries:      true,
+			IgnoreRecordNotFoundError: true,
+		}),
+	})
 	if err != nil {
-		log.Fatal("failed to start connection with database:", err)
+		logger.Fatal("failed to start connection with database", logger.Err(err))
+	}
+
+	// Query variables are left out of spans to keep PII out of traces.
+	if err := db.Use(gormtracing.NewPlugin(
+		gormtracing.WithDBSystem("postgresql"),
+		gormtracing.WithoutQueryVariables(),
+		gormtracing.WithoutMetrics(),
+	)); err != nil {
+		logger.Fatal("failed to instrument database", logger.Err(err))
 	}
 
 	if err := db.AutoMigrate(
 		&models.User{},
 	); err != nil {
-		log.Fatal("failed to run the auto migrate process:", err)
+		logger.Fatal("failed to run the auto migrate process", logger.Err(err))
 	}
 
-	log.Println("database migration completed successfully!")
+	slog.Info("database migration completed successfully")
 
 	return db
 }
+
+func DBHealthCheck(db *gorm.DB) health.Check {
+	return health.Check{
+		Name: "postgres",
+		Check: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
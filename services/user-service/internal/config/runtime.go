@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"ms-ride-sharing/shared/jwt"
+	"time"
+)
+
+// Runtime holds the settings that can change without a restart. It is read
+// from the file at RUNTIME_CONFIG_PATH, usually a mounted ConfigMap.
+type Runtime struct {
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	LogLevel        string        `yaml:"log_level"`
+}
+
+func DefaultRuntime() Runtime {
+	return Runtime{
+		AccessTokenTTL:  jwt.ACCESS_EXPIRATION,
+		RefreshTokenTTL: jwt.REFRESH_EXPIRATION,
+		LogLevel:        "info",
+	}
+}
+
+func (r *Runtime) Validate() error {
+	if r.AccessTokenTTL < time.Minute {
+		return fmt.Errorf("access_token_ttl: must be at least 1m, got %s", r.AccessTokenTTL)
+	}
+
+	if r.RefreshTokenTTL <= r.AccessTokenTTL {
+		return fmt.Errorf("refresh_token_ttl: must be longer than access_token_ttl")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(r.LogLevel)); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+
+	return nil
+}
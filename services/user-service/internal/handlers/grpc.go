@@ -3,18 +3,33 @@ package handlers
 import (
 	"context"
 	"errors"
-	"log"
 	"ms-ride-sharing/services/user-service/internal/service"
+	"ms-ride-sharing/shared/authz"
+	"ms-ride-sharing/shared/grpcx"
 	"ms-ride-sharing/shared/jwt"
 	userpb "ms-ride-sharing/shared/proto/v1/user"
+	"time"
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
+const ErrorDomain = "user-service"
+
+// ErrorMappings translates the service errors returned by the handlers into
+// gRPC status codes and stable reason codes. Anything not listed is reported
+// as Internal.
+var ErrorMappings = []grpcx.ErrorMapping{
+	{Err: service.ErrInvalidCredentials, Code: codes.InvalidArgument, Reason: "INVALID_CREDENTIALS"},
+	{Err: service.ErrInvalidToken, Code: codes.Unauthenticated, Reason: "TOKEN_INVALID"},
+	{Err: service.ErrInvalidTokenType, Code: codes.Unauthenticated, Reason: "TOKEN_TYPE_INVALID"},
+	{Err: service.ErrRefreshTokenReuseDetected, Code: codes.PermissionDenied, Reason: "REFRESH_TOKEN_REUSED"},
+	{Err: service.ErrSessionExpired, Code: codes.Unauthenticated, Reason: "SESSION_EXPIRED"},
+	{Err: service.ErrSessionStoreUnavailable, Code: codes.Unavailable, Reason: "SESSION_STORE_UNAVAILABLE", RetryAfter: 2 * time.Second},
+	{Err: service.ErrInternalServer, Code: codes.Internal, Reason: grpcx.ReasonInternal},
+}
+
 type GRPCHandler struct {
 	userpb.UnimplementedUserServiceServer
 	userService *service.UserService
@@ -36,9 +51,6 @@ func NewGRPCHandler(
 }
 
 func (h *GRPCHandler) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.CreateUserResponse, error) {
-	if err := req.ValidateAll(); err != nil {
-		return nil, status.Error(codes.InvalidArgument, err.Error())
-	}
 	user, err := h.userService.CreateUser(ctx, req)
 
 	if err != nil {
@@ -48,45 +60,24 @@ func (h *GRPCHandler) CreateUser(ctx context.Context, req *userpb.CreateUserRequ
 			return &userpb.CreateUserResponse{Id: uuid.New().String()}, nil
 		}
 
-		log.Printf("create user error: %v", err)
-		return nil, status.Error(codes.Internal, service.ErrInternalServer.Error())
+		return nil, err
 	}
 
 	return &userpb.CreateUserResponse{Id: user.ID.String()}, nil
 }
 
 func (h *GRPCHandler) Login(ctx context.Context, req *userpb.LoginRequest) (*userpb.LoginResponse, error) {
-	authRes, err := h.userService.Authenticate(ctx, req.Email, req.Password)
-	if err != nil {
-		log.Printf("login error: %v", err)
-		switch {
-		case errors.Is(err, service.ErrInvalidCredentials):
-			return nil, status.Error(codes.InvalidArgument, service.ErrInvalidCredentials.Error())
-		case errors.Is(err, service.ErrInternalServer):
-			return nil, status.Error(codes.Internal, service.ErrInternalServer.Error())
-		default:
-			return nil, status.Error(codes.Internal, "unexpected error")
-		}
-	}
-
-	return authRes, nil
+	return h.userService.Authenticate(ctx, req.Email, req.Password)
 }
 
 func (h *GRPCHandler) Logout(ctx context.Context, req *userpb.LogoutRequest) (*userpb.LogoutResponse, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	var userID string
+	// Logout is not public, so the auth interceptor already rejected calls
+	// without an identity.
+	id, _ := authz.FromContext(ctx)
 
-	if ok && len(md.Get("x-user-id")) > 0 {
-		userID = md.Get("x-user-id")[0]
-	}
-
-	if userID == "" {
-		return nil, status.Error(codes.Unauthenticated, "user_id is required")
-	}
-
-	ok, err := h.userService.Logout(ctx, userID)
+	ok, err := h.userService.Logout(ctx, id.UserID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, service.ErrInternalServer.Error())
+		return nil, err
 	}
 
 	return &userpb.LogoutResponse{Success: ok}, nil
@@ -95,18 +86,7 @@ func (h *GRPCHandler) Logout(ctx context.Context, req *userpb.LogoutRequest) (*u
 func (h *GRPCHandler) RefreshToken(ctx context.Context, req *userpb.RefreshTokenRequest) (*userpb.RefreshTokenResponse, error) {
 	data, err := h.userService.RefreshToken(ctx, req.Token)
 	if err != nil {
-		switch {
-		case errors.Is(err, service.ErrInvalidToken):
-			return nil, status.Error(codes.Unauthenticated, service.ErrInvalidToken.Error())
-		case errors.Is(err, service.ErrInvalidTokenType):
-			return nil, status.Error(codes.Unauthenticated, service.ErrInvalidTokenType.Error())
-		case errors.Is(err, service.ErrRefreshTokenReuseDetected):
-			return nil, status.Error(codes.PermissionDenied, service.ErrRefreshTokenReuseDetected.Error())
-		case errors.Is(err, service.ErrInternalServer):
-			return nil, status.Error(codes.Internal, service.ErrInternalServer.Error())
-		default:
-			return nil, status.Error(codes.Internal, "unexpected error")
-		}
+		return nil, err
 	}
 
 	return &userpb.RefreshTokenResponse{
@@ -114,3 +94,17 @@ func (h *GRPCHandler) RefreshToken(ctx context.Context, req *userpb.RefreshToken
 		RefreshToken: data.RefreshToken,
 	}, nil
 }
+
+func (h *GRPCHandler) CreateWebSocketTicket(ctx context.Context, req *userpb.CreateWebSocketTicketRequest) (*userpb.CreateWebSocketTicketResponse, error) {
+	id, _ := authz.FromContext(ctx)
+
+	ticket, ttl, err := h.userService.IssueWebSocketTicket(ctx, id.UserID, id.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userpb.CreateWebSocketTicketResponse{
+		Ticket:           ticket,
+		ExpiresInSeconds: int32(ttl.Seconds()),
+	}, nil
+}
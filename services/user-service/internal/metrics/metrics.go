@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"ms-ride-sharing/shared/logger"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+var (
+	Registrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "user_registrations_total",
+		Help: "Users registered, by user type.",
+	}, []string{"user_type"})
+
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "user_logins_total",
+		Help: "Login attempts, by result.",
+	}, []string{"result"})
+
+	RefreshTokenReuse = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "user_refresh_token_reuse_total",
+		Help: "Refresh tokens presented after being rotated, which invalidates the session.",
+	})
+)
+
+var activeSessionsDesc = prometheus.NewDesc(
+	"user_active_sessions",
+	"Users with a live access session in Redis.",
+	nil, nil,
+)
+
+// RegisterActiveSessions exports the number of session keys in Redis. The
+// count needs a SCAN over the keyspace, so it is cached for cacheFor and
+// refreshed on scrape at most that often.
+func RegisterActiveSessions(rdb *redis.Client, cacheFor time.Duration) error {
+	return prometheus.Register(&sessionCollector{rdb: rdb, cacheFor: cacheFor})
+}
+
+type sessionCollector struct {
+	rdb      *redis.Client
+	cacheFor time.Duration
+
+	mu        sync.Mutex
+	count     float64
+	refreshed time.Time
+}
+
+func (c *sessionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+}
+
+func (c *sessionCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.refreshed) >= c.cacheFor {
+		count, err := c.countSessions()
+		if err != nil {
+			slog.Warn("error counting active sessions", logger.Err(err))
+		} else {
+			c.count = float64(count)
+			c.refreshed = time.Now()
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, c.count)
+}
+
+func (c *sessionCollector) countSessions() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count := 0
+	iter := c.rdb.Scan(ctx, 0, "session:*", 1000).Iterator()
+	for iter.Next(ctx) {
+		count++
+	}
+	return count, iter.Err()
+}
@@ -9,4 +9,6 @@ var (
 	ErrInvalidToken              = errors.New("invalid token")
 	ErrInvalidTokenType          = errors.New("invalid token type")
 	ErrRefreshTokenReuseDetected = errors.New("refresh token reuse detected; session invalidated")
+	ErrSessionStoreUnavailable   = errors.New("session store unavailable")
+	ErrSessionExpired            = errors.New("session expired")
 )
@@ -4,31 +4,40 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"ms-ride-sharing/services/user-service/internal/metrics"
 	"ms-ride-sharing/services/user-service/internal/models"
 	"ms-ride-sharing/services/user-service/internal/repository"
 	"ms-ride-sharing/services/user-service/pkg"
 	"ms-ride-sharing/shared/jwt"
+	"ms-ride-sharing/shared/logger"
 	userpb "ms-ride-sharing/shared/proto/v1/user"
+	"ms-ride-sharing/shared/session"
 	"ms-ride-sharing/shared/types"
+	"time"
 
 	jwtLib "github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
 	"gorm.io/gorm"
 )
 
+var tracer = otel.Tracer("ms-ride-sharing/services/user-service/internal/service")
+
 type UserService struct {
 	repo       repository.UserRepository
 	jwtService *jwt.JWTService
 	rdbRepo    *redis.Client
+	ticketTTL  time.Duration
 }
 
-func NewUserService(repo repository.UserRepository, jwtService *jwt.JWTService, rdbRepo *redis.Client) *UserService {
+func NewUserService(repo repository.UserRepository, jwtService *jwt.JWTService, rdbRepo *redis.Client, ticketTTL time.Duration) *UserService {
 	return &UserService{
 		repo:       repo,
 		jwtService: jwtService,
 		rdbRepo:    rdbRepo,
+		ticketTTL:  ticketTTL,
 	}
 }
 
@@ -42,7 +51,9 @@ func (s *UserService) CreateUser(ctx context.Context, user *userpb.CreateUserReq
 		return nil, ErrUserAlreadyExists
 	}
 
+	_, span := tracer.Start(ctx, "bcrypt.hash")
 	hashedPassword, err := pkg.HashPassword(user.Password)
+	span.End()
 	if err != nil {
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
@@ -60,40 +71,51 @@ func (s *UserService) CreateUser(ctx context.Context, user *userpb.CreateUserReq
 		return nil, ErrInternalServer
 	}
 
+	metrics.Registrations.WithLabelValues(string(modelUser.UserType)).Inc()
+
 	return modelUser, nil
 }
 
 func (s *UserService) Authenticate(ctx context.Context, email, password string) (*userpb.LoginResponse, error) {
 	user, err := s.repo.GetByEmail(ctx, email)
 	if err != nil || user == nil {
-		log.Printf("error getting user by email: %v", err)
+		slog.InfoContext(ctx, "login failed: user lookup", logger.Err(err))
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
 		return nil, ErrInvalidCredentials
 	}
 
+	_, span := tracer.Start(ctx, "bcrypt.compare")
 	err = pkg.CheckPassword(user.HashedPassword, password)
+	span.End()
 	if err != nil {
-		log.Printf("error checking password: %v", err)
+		slog.InfoContext(ctx, "login failed: password mismatch", slog.String("user_id", user.ID.String()))
+		metrics.Logins.WithLabelValues(metrics.LoginFailure).Inc()
 		return nil, ErrInvalidCredentials
 	}
 
-	accessTokenData, err := s.jwtService.GenerateToken(user.ID.String(), jwt.ACCESS)
+	accessTokenData, err := s.jwtService.GenerateToken(user.ID.String(), string(user.UserType), jwt.ACCESS)
 	if err != nil {
 		return nil, ErrInternalServer
 	}
-	refreshTokenData, err := s.jwtService.GenerateToken(user.ID.String(), jwt.REFRESH)
+	refreshTokenData, err := s.jwtService.GenerateToken(user.ID.String(), string(user.UserType), jwt.REFRESH)
 	if err != nil {
 		return nil, ErrInternalServer
 	}
 
 	pipe := s.rdbRepo.Pipeline()
 
-	pipe.Set(ctx, "session:"+user.ID.String(), accessTokenData.JTI, jwt.ACCESS_EXPIRATION)
-	pipe.Set(ctx, "refresh_session:"+user.ID.String(), refreshTokenData.JTI, jwt.REFRESH_EXPIRATION)
+	pipe.Set(ctx, "session:"+user.ID.String(), accessTokenData.JTI, s.jwtService.AccessExpiration())
+	pipe.Set(ctx, "refresh_session:"+user.ID.String(), refreshTokenData.JTI, s.jwtService.RefreshExpiration())
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
-		return nil, err
+		slog.ErrorContext(ctx, "error storing session", logger.Err(err))
+		return nil, ErrSessionStoreUnavailable
 	}
+	// A new login replaces the previous session.
+	s.publishRevocation(ctx, user.ID.String())
+
+	metrics.Logins.WithLabelValues(metrics.LoginSuccess).Inc()
 
 	return &userpb.LoginResponse{
 		Id:           user.ID.String(),
@@ -112,8 +134,10 @@ func (s *UserService) Logout(ctx context.Context, userId string) (bool, error) {
 		"refresh_session:"+userId,
 	).Err()
 	if err != nil {
-		return false, ErrInternalServer
+		slog.ErrorContext(ctx, "error deleting session", logger.Err(err))
+		return false, ErrSessionStoreUnavailable
 	}
+	s.publishRevocation(ctx, userId)
 
 	return true, nil
 }
@@ -133,26 +157,102 @@ func (s *UserService) RefreshToken(ctx context.Context, tokenStr string) (*Token
 	incomingJTI := claims["jti"].(string)
 
 	currentRefreshJTI, err := s.rdbRepo.Get(ctx, "refresh_session:"+userID).Result()
-	if err != nil || currentRefreshJTI != incomingJTI {
+	if errors.Is(err, redis.Nil) {
+		// Logged out or expired: nothing left to protect, so not a reuse.
+		return nil, ErrSessionExpired
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error loading refresh session", logger.Err(err))
+		return nil, ErrSessionStoreUnavailable
+	}
+	if currentRefreshJTI != incomingJTI {
 		// Ensures the endpoint cannot be used with a previously issued refresh token
 		s.rdbRepo.Del(ctx, "session:"+userID, "refresh_session:"+userID)
+		s.publishRevocation(ctx, userID)
+		metrics.RefreshTokenReuse.Inc()
+		slog.WarnContext(ctx, "refresh token reuse detected", slog.String("user_id", userID))
 		return nil, ErrRefreshTokenReuseDetected
 	}
 
-	accessTokenData, err := s.jwtService.GenerateToken(userID, jwt.ACCESS)
+	role, err := s.tokenRole(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenData, err := s.jwtService.GenerateToken(userID, role, jwt.ACCESS)
 	if err != nil {
 		return nil, ErrInternalServer
 	}
-	refreshTokenData, err := s.jwtService.GenerateToken(userID, jwt.REFRESH)
+	refreshTokenData, err := s.jwtService.GenerateToken(userID, role, jwt.REFRESH)
 	if err != nil {
 		return nil, ErrInternalServer
 	}
 
-	s.rdbRepo.Set(ctx, "session:"+userID, accessTokenData.JTI, jwt.ACCESS_EXPIRATION)
-	s.rdbRepo.Set(ctx, "refresh_session:"+userID, refreshTokenData.JTI, jwt.REFRESH_EXPIRATION)
+	pipe := s.rdbRepo.Pipeline()
+
+	pipe.Set(ctx, "session:"+userID, accessTokenData.JTI, s.jwtService.AccessExpiration())
+	pipe.Set(ctx, "refresh_session:"+userID, refreshTokenData.JTI, s.jwtService.RefreshExpiration())
+
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "error storing session", logger.Err(err))
+		return nil, ErrSessionStoreUnavailable
+	}
+	s.publishRevocation(ctx, userID)
 
 	return &TokenResponse{
 		AccessToken:  accessTokenData.SignedToken,
 		RefreshToken: refreshTokenData.SignedToken,
 	}, nil
 }
+
+// IssueWebSocketTicket issues a ticket bound to the current session of
+// userID, so logging out also invalidates tickets not yet redeemed.
+func (s *UserService) IssueWebSocketTicket(ctx context.Context, userID, role string) (string, time.Duration, error) {
+	jti, err := s.rdbRepo.Get(ctx, "session:"+userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", 0, ErrSessionExpired
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error loading session", logger.Err(err))
+		return "", 0, ErrSessionStoreUnavailable
+	}
+
+	ticket, err := session.IssueTicket(ctx, s.rdbRepo, session.Ticket{UserID: userID, Role: role, JTI: jti}, s.ticketTTL)
+	if err != nil {
+		slog.ErrorContext(ctx, "error storing ws ticket", logger.Err(err))
+		return "", 0, ErrSessionStoreUnavailable
+	}
+	return ticket, s.ticketTTL, nil
+}
+
+// publishRevocation tells the gateways to drop their cached session of
+// userID. A lost message only delays revocation until the cache entry
+// expires, so failures are logged and not returned.
+func (s *UserService) publishRevocation(ctx context.Context, userID string) {
+	if err := session.PublishRevocation(ctx, s.rdbRepo, userID); err != nil {
+		slog.WarnContext(ctx, "error publishing session revocation", slog.String("user_id", userID), logger.Err(err))
+	}
+}
+
+// tokenRole returns the role carried by a refresh token, looking it up for
+// tokens issued before roles were added to the claims.
+func (s *UserService) tokenRole(ctx context.Context, claims jwtLib.MapClaims) (string, error) {
+	if role, ok := claims["role"].(string); ok && role != "" {
+		return role, nil
+	}
+
+	id, err := uuid.Parse(claims["sub"].(string))
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	user, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error loading user role", logger.Err(err))
+		return "", ErrInternalServer
+	}
+	return string(user.UserType), nil
+}
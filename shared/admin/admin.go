@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Server is an HTTP listener for operational endpoints (runtime config,
+// diagnostics) kept apart from the public traffic port.
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func NewServer(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start serves in the background. An empty address disables the server.
+func (s *Server) Start() {
+	if s.server.Addr == "" {
+		return
+	}
+
+	go func() {
+		slog.Info("admin server listening", slog.String("addr", s.server.Addr))
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin server error", slog.Any("error", err))
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server.Addr == "" {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
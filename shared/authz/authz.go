@@ -0,0 +1,138 @@
+package authz
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"ms-ride-sharing/shared/proto/v1/ridesharing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Rule is the (ridesharing.auth) option of an RPC. RPCs without the option
+// get the zero Rule: any authenticated user may call them.
+type Rule struct {
+	Public bool
+	Roles  []string
+}
+
+// Allows reports whether a user with role may call the RPC.
+func (r Rule) Allows(role string) bool {
+	return len(r.Roles) == 0 || slices.Contains(r.Roles, role)
+}
+
+// Registry holds the auth rules declared in the proto files, keyed both by
+// full gRPC method name and by the HTTP routes bound with google.api.http.
+type Registry struct {
+	methods map[string]Rule
+	routes  map[string]Rule
+	// primary maps a method to the first of its HTTP routes.
+	primary map[string]string
+}
+
+// NewRegistry reads the rules of every service in files.
+func NewRegistry(files ...protoreflect.FileDescriptor) *Registry {
+	r := &Registry{methods: map[string]Rule{}, routes: map[string]Rule{}, primary: map[string]string{}}
+	for _, file := range files {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				rule := methodRule(method)
+
+				fullMethod := fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+				r.methods[fullMethod] = rule
+				routes := HTTPRoutes(method)
+				for _, route := range routes {
+					r.routes[route] = rule
+				}
+				if len(routes) > 0 {
+					r.primary[fullMethod] = routes[0]
+				}
+			}
+		}
+	}
+	return r
+}
+
+func methodRule(method protoreflect.MethodDescriptor) Rule {
+	opt, ok := proto.GetExtension(method.Options(), ridesharing.E_Auth).(*ridesharing.AuthRule)
+	if !ok || opt == nil {
+		return Rule{}
+	}
+	return Rule{Public: opt.GetPublic(), Roles: opt.GetRoles()}
+}
+
+// Method returns the rule of a gRPC method, e.g. /ridesharing.v1.UserService/Login.
+// Methods outside the registry, such as health checks, are not found.
+func (r *Registry) Method(fullMethod string) (Rule, bool) {
+	rule, ok := r.methods[fullMethod]
+	return rule, ok
+}
+
+// Methods lists the full gRPC method names of the registry, sorted.
+func (r *Registry) Methods() []string {
+	methods := make([]string, 0, len(r.methods))
+	for method := range r.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// PrimaryRoute returns the first HTTP route bound to a gRPC method, in
+// METHOD:/template form. Methods without google.api.http have none.
+func (r *Registry) PrimaryRoute(fullMethod string) (string, bool) {
+	route, ok := r.primary[fullMethod]
+	return route, ok
+}
+
+// Route returns the rule of an HTTP route in METHOD:/template form.
+func (r *Registry) Route(route string) (Rule, bool) {
+	rule, ok := r.routes[route]
+	return rule, ok
+}
+
+// Routes lists the HTTP routes of the registry, sorted.
+func (r *Registry) Routes() []string {
+	routes := make([]string, 0, len(r.routes))
+	for route := range r.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// Validate checks that every role used in a rule is one of roles and that no
+// public RPC also restricts roles, which would be meaningless.
+func (r *Registry) Validate(roles []string) error {
+	for _, method := range r.Methods() {
+		rule := r.methods[method]
+		if rule.Public && len(rule.Roles) > 0 {
+			return fmt.Errorf("%s: public methods cannot restrict roles", method)
+		}
+		for _, role := range rule.Roles {
+			if !slices.Contains(roles, role) {
+				return fmt.Errorf("%s: unknown role %q, expected one of %s", method, role, strings.Join(roles, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+var shortVariable = regexp.MustCompile(`\{([^=}]+)\}`)
+
+// NormalizeRoute turns METHOD:/path/{var} into the form grpc-gateway reports
+// for matched patterns, METHOD:/path/{var=*}.
+func NormalizeRoute(key string) (string, error) {
+	method, path, ok := strings.Cut(key, ":")
+	if !ok || method == "" || !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("route %q must be in METHOD:/path format", key)
+	}
+	return strings.ToUpper(method) + ":" + shortVariable.ReplaceAllString(path, "{$1=*}"), nil
+}
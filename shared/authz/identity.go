@@ -0,0 +1,70 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"ms-ride-sharing/shared/requestid"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Identity is the authenticated user a call is made for.
+type Identity struct {
+	UserID string
+	Role   string
+}
+
+type identityKey struct{}
+
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// FromIncomingMetadata reads the identity the gateway signed for this call.
+// It returns false without an error when the call carries no identity, and
+// an error when the token is forged, expired or was minted for another
+// request.
+func FromIncomingMetadata(ctx context.Context, v *Verifier) (Identity, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return Identity{}, false, nil
+	}
+	token, err := single(md, IdentityMetadataKey)
+	if err != nil || token == "" {
+		return Identity{}, false, err
+	}
+
+	id, requestID, err := v.Verify(token)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	if requestID != "" {
+		callRequestID, err := single(md, requestid.MetadataKey)
+		if err != nil {
+			return Identity{}, false, err
+		}
+		if requestID != callRequestID {
+			return Identity{}, false, fmt.Errorf("%w: minted for another request", ErrInvalidIdentity)
+		}
+	}
+	return id, true, nil
+}
+
+// single returns the only value of key in md. More than one value means a
+// caller added its own next to the gateway's, so the call is refused rather
+// than trusting either.
+func single(md metadata.MD, key string) (string, error) {
+	values := md.Get(key)
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		return values[0], nil
+	}
+	return "", fmt.Errorf("%w: %d values for %s", ErrInvalidIdentity, len(values), key)
+}
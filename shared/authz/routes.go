@@ -0,0 +1,49 @@
+package authz
+
+import (
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// HTTPRoutes lists the routes bound to method with google.api.http, which
+// are the routes grpc-gateway registers for it.
+func HTTPRoutes(method protoreflect.MethodDescriptor) []string {
+	rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+
+	var routes []string
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		if route, ok := httpRoute(r); ok {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func httpRoute(rule *annotations.HttpRule) (string, bool) {
+	var method, path string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, path = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Post:
+		method, path = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Put:
+		method, path = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Delete:
+		method, path = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		method, path = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		method, path = pattern.Custom.GetKind(), pattern.Custom.GetPath()
+	default:
+		return "", false
+	}
+
+	route, err := NormalizeRoute(method + ":" + path)
+	return route, err == nil
+}
@@ -1,9 +1,6 @@
 package env
 
-import (
-	"os"
-	"strconv"
-)
+import "os"
 
 func GetString(key, fallback string) string {
 	val, ok := os.LookupEnv(key)
@@ -13,31 +10,3 @@ func GetString(key, fallback string) string {
 
 	return val
 }
-
-func GetInt(key string, fallback int) int {
-	val, ok := os.LookupEnv(key)
-	if !ok {
-		return fallback
-	}
-
-	valAsInt, err := strconv.Atoi(val)
-	if err != nil {
-		return fallback
-	}
-
-	return valAsInt
-}
-
-func GetBool(key string, fallback bool) bool {
-	val, ok := os.LookupEnv(key)
-	if !ok {
-		return fallback
-	}
-
-	boolVal, err := strconv.ParseBool(val)
-	if err != nil {
-		return fallback
-	}
-
-	return boolVal
-}
@@ -0,0 +1,321 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvironmentKey = "ENVIRONMENT"
+	Production     = "production"
+)
+
+// Validator is implemented by config structs that need cross-field checks
+// after every field has been loaded.
+type Validator interface {
+	Validate() error
+}
+
+type source int
+
+const (
+	sourceDefault source = iota
+	sourceFile
+	sourceSecretFile
+	sourceEnv
+)
+
+type options struct {
+	filePath string
+}
+
+type Option func(*options)
+
+// WithFile adds a YAML file as a source of values. Keys are the `yaml` tag of
+// the field or, when missing, the lowercase env name. An empty path is ignored.
+func WithFile(path string) Option {
+	return func(o *options) {
+		o.filePath = path
+	}
+}
+
+// FieldError describes a single config field that could not be loaded.
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrRequired       = errors.New("required value is missing")
+	ErrInsecureSecret = errors.New("default secret is not allowed in production")
+	ErrEmptySecret    = errors.New("secret must not be empty")
+)
+
+// Load fills the struct pointed to by dst using its `env` tags. For each field
+// the value is resolved, in order of precedence, from the env var, the file
+// referenced by <NAME>_FILE, the YAML file and finally the `default` tag.
+// Every invalid or missing value is reported in the returned error.
+//
+// Supported tags:
+//
+//	env:"NAME"        env var name (fields without it are skipped)
+//	default:"value"   fallback value
+//	required:"true"   fail when no source provides a non-blank value
+//	secret:"true"     refuse a blank value, and the default in production
+//	yaml:"key"        key in the YAML file
+func Load(dst any, opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("env: Load expects a pointer to struct, got %T", dst)
+	}
+
+	fileValues, err := readYAMLFile(o.filePath)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs           []error
+		defaultSecrets []string
+		environment    = GetString(EnvironmentKey, "development")
+		structValue    = rv.Elem()
+		structType     = structValue.Type()
+	)
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		key, ok := field.Tag.Lookup("env")
+		if !ok || key == "" || !field.IsExported() {
+			continue
+		}
+
+		raw, src, err := lookup(key, field, fileValues)
+		if err != nil {
+			errs = append(errs, &FieldError{Key: key, Err: err})
+			continue
+		}
+
+		// A variable that is set but blank, e.g. a secretKeyRef resolving to
+		// an empty string, counts as missing. An empty HMAC key still signs
+		// and verifies, so secrets are never allowed to be blank.
+		if strings.TrimSpace(raw) == "" {
+			switch {
+			case field.Tag.Get("required") == "true":
+				errs = append(errs, &FieldError{Key: key, Err: ErrRequired})
+				continue
+			case field.Tag.Get("secret") == "true":
+				errs = append(errs, &FieldError{Key: key, Err: ErrEmptySecret})
+				continue
+			}
+		}
+		if raw == "" {
+			continue
+		}
+
+		if err := setValue(structValue.Field(i), raw); err != nil {
+			errs = append(errs, &FieldError{Key: key, Err: err})
+			continue
+		}
+
+		if key == EnvironmentKey {
+			environment = raw
+		}
+		if src == sourceDefault && field.Tag.Get("secret") == "true" {
+			defaultSecrets = append(defaultSecrets, key)
+		}
+	}
+
+	if environment == Production {
+		for _, key := range defaultSecrets {
+			errs = append(errs, &FieldError{Key: key, Err: ErrInsecureSecret})
+		}
+	}
+
+	if len(errs) == 0 {
+		if v, ok := dst.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// MustLoad is like Load but exits the process when the configuration is invalid.
+func MustLoad(dst any, opts ...Option) {
+	if err := Load(dst, opts...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func lookup(key string, field reflect.StructField, fileValues map[string]any) (string, source, error) {
+	if val, ok := os.LookupEnv(key); ok {
+		return val, sourceEnv, nil
+	}
+
+	if path, ok := os.LookupEnv(key + "_FILE"); ok && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", sourceSecretFile, fmt.Errorf("reading %s_FILE: %w", key, err)
+		}
+		return strings.TrimSpace(string(content)), sourceSecretFile, nil
+	}
+
+	yamlKey := field.Tag.Get("yaml")
+	if yamlKey == "" {
+		yamlKey = strings.ToLower(key)
+	}
+	if val, ok := fileValues[yamlKey]; ok && val != nil {
+		return yamlScalar(val), sourceFile, nil
+	}
+
+	return field.Tag.Get("default"), sourceDefault, nil
+}
+
+func readYAMLFile(path string) (map[string]any, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("env: reading config file: %w", err)
+	}
+
+	values := map[string]any{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("env: parsing config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+func yamlScalar(val any) string {
+	if list, ok := val.([]any); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(val)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+func setValue(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case v.Type() == urlType:
+		u, err := parseURL(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(*u))
+		return nil
+	case v.Kind() == reflect.Pointer && v.Type().Elem() == urlType:
+		u, err := parseURL(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(u))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := splitList(raw)
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), part); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
+
+func parseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", raw)
+	}
+	return u, nil
+}
+
+func splitList(raw string) []string {
+	var parts []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
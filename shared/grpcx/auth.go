@@ -0,0 +1,76 @@
+package grpcx
+
+import (
+	"context"
+	"log/slog"
+
+	"ms-ride-sharing/shared/authz"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	ReasonIdentityMissing = "IDENTITY_MISSING"
+	ReasonIdentityInvalid = "IDENTITY_INVALID"
+	ReasonRoleNotAllowed  = "ROLE_NOT_ALLOWED"
+)
+
+// WithAuthorization enforces the (ridesharing.auth) rules of registry on
+// every call, trusting only identities signed with the secret of verifier.
+// Methods outside the registry, such as health checks, are let through.
+func WithAuthorization(registry *authz.Registry, verifier *authz.Verifier) Option {
+	return func(o *options) {
+		o.authz = registry
+		o.identities = verifier
+	}
+}
+
+func (o *options) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := o.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (o *options) streamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := o.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorize stores the caller identity in ctx, when there is one, and checks
+// it against the rule of method.
+func (o *options) authorize(ctx context.Context, method string) (context.Context, error) {
+	if o.authz == nil {
+		return ctx, nil
+	}
+	rule, ok := o.authz.Method(method)
+	if !ok {
+		return ctx, nil
+	}
+
+	id, ok, err := authz.FromIncomingMetadata(ctx, o.identities)
+	if err != nil {
+		// A bad signature is never ignored, even on public methods: it means
+		// the caller is not the gateway or the secrets are out of sync.
+		slog.WarnContext(ctx, "rejected internal identity", slog.String("method", method), slog.Any("error", err))
+		return ctx, NewError(codes.Unauthenticated, ReasonIdentityInvalid, o.errorDomain, "caller identity could not be verified", 0)
+	}
+	if ok {
+		ctx = authz.NewContext(ctx, id)
+	}
+
+	switch {
+	case rule.Public:
+		return ctx, nil
+	case !ok:
+		return ctx, NewError(codes.Unauthenticated, ReasonIdentityMissing, o.errorDomain, "caller identity is required", 0)
+	case !rule.Allows(id.Role):
+		return ctx, NewError(codes.PermissionDenied, ReasonRoleNotAllowed, o.errorDomain, "method not allowed for this user type", 0)
+	}
+	return ctx, nil
+}
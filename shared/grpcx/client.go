@@ -0,0 +1,120 @@
+package grpcx
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// RetryPolicy is the gRPC retry policy applied to idempotent methods.
+type RetryPolicy struct {
+	MaxAttempts       int
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+	// RetryableCodes are status code names as used in service configs,
+	// e.g. UNAVAILABLE.
+	RetryableCodes []string
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    100 * time.Millisecond,
+		MaxBackoff:        time.Second,
+		BackoffMultiplier: 2,
+		RetryableCodes:    []string{"UNAVAILABLE"},
+	}
+}
+
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	MethodConfig        []methodConfig        `json:"methodConfig"`
+}
+
+type methodConfig struct {
+	Name        []methodName       `json:"name"`
+	RetryPolicy *retryPolicyConfig `json:"retryPolicy,omitempty"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicyConfig struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// ServiceConfig builds the client service config for the services in files,
+// to be passed to grpc.WithDefaultServiceConfig. Only methods marked with
+// idempotency_level IDEMPOTENT or NO_SIDE_EFFECTS are retried: retrying
+// anything else (e.g. a token refresh) can apply it twice. Calls are balanced
+// with round_robin over every resolved address, so a target backed by a
+// headless Kubernetes service spreads load across its pods.
+func ServiceConfig(retry RetryPolicy, files ...protoreflect.FileDescriptor) (string, error) {
+	var idempotent []methodName
+	for _, file := range files {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				if !isIdempotent(method) {
+					continue
+				}
+				idempotent = append(idempotent, methodName{
+					Service: string(method.Parent().FullName()),
+					Method:  string(method.Name()),
+				})
+			}
+		}
+	}
+
+	cfg := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{"round_robin": {}}},
+		MethodConfig:        []methodConfig{},
+	}
+	if len(idempotent) > 0 && retry.MaxAttempts > 1 {
+		cfg.MethodConfig = append(cfg.MethodConfig, methodConfig{
+			Name: idempotent,
+			RetryPolicy: &retryPolicyConfig{
+				MaxAttempts:          retry.MaxAttempts,
+				InitialBackoff:       durationString(retry.InitialBackoff),
+				MaxBackoff:           durationString(retry.MaxBackoff),
+				BackoffMultiplier:    retry.BackoffMultiplier,
+				RetryableStatusCodes: retry.RetryableCodes,
+			},
+		})
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func isIdempotent(method protoreflect.MethodDescriptor) bool {
+	opts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil {
+		return false
+	}
+	switch opts.GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_IDEMPOTENT, descriptorpb.MethodOptions_NO_SIDE_EFFECTS:
+		return true
+	}
+	return false
+}
+
+// durationString formats d the way service configs expect, e.g. "0.1s".
+func durationString(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
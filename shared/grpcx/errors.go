@@ -0,0 +1,133 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Reason codes attached as ErrorInfo to errors raised by the interceptors.
+const (
+	ReasonValidationFailed = "VALIDATION_FAILED"
+	ReasonInternal         = "INTERNAL"
+	ReasonDeadlineExceeded = "DEADLINE_EXCEEDED"
+	ReasonCanceled         = "CANCELED"
+)
+
+// ErrorMapping translates a domain error, matched with errors.Is, into the
+// gRPC status returned to the caller. Reason is a stable machine-readable
+// code sent as ErrorInfo; RetryAfter, when set, is sent as RetryInfo.
+type ErrorMapping struct {
+	Err        error
+	Code       codes.Code
+	Reason     string
+	RetryAfter time.Duration
+}
+
+// NewError builds a status error carrying an ErrorInfo with reason and,
+// when retryAfter is positive, a RetryInfo telling clients when to retry.
+func NewError(code codes.Code, reason, domain, msg string, retryAfter time.Duration) error {
+	st := status.New(code, msg)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: domain}}
+	if retryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// translateError leaves status errors untouched, maps known domain errors to
+// their code and hides anything else behind a generic Internal error.
+func (o *options) translateError(ctx context.Context, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewError(codes.DeadlineExceeded, ReasonDeadlineExceeded, o.errorDomain, err.Error(), 0)
+	case errors.Is(err, context.Canceled):
+		return NewError(codes.Canceled, ReasonCanceled, o.errorDomain, err.Error(), 0)
+	}
+
+	for _, m := range o.errorMappings {
+		if errors.Is(err, m.Err) {
+			return NewError(m.Code, m.Reason, o.errorDomain, m.Err.Error(), m.RetryAfter)
+		}
+	}
+
+	slog.ErrorContext(ctx, "unmapped error", slog.String("method", method), slog.Any("error", err))
+	return o.internalError()
+}
+
+func (o *options) internalError() error {
+	return NewError(codes.Internal, ReasonInternal, o.errorDomain, "internal server error", 0)
+}
+
+// fieldViolation is implemented by the per-field errors generated by
+// protoc-gen-validate; multiError by the aggregate returned from ValidateAll.
+type fieldViolation interface {
+	Field() string
+	Reason() string
+}
+
+type multiError interface {
+	AllErrors() []error
+}
+
+// validationError turns a protoc-gen-validate error into InvalidArgument with
+// a BadRequest detail listing every violated field by its JSON name.
+func (o *options) validationError(err error) error {
+	errs := []error{err}
+	if multi, ok := err.(multiError); ok {
+		errs = multi.AllErrors()
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, e := range errs {
+		var violation fieldViolation
+		if errors.As(e, &violation) {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       jsonFieldName(violation.Field()),
+				Description: violation.Reason(),
+			})
+		}
+	}
+
+	st := status.New(codes.InvalidArgument, err.Error())
+	withDetails, detailsErr := st.WithDetails(
+		&errdetails.ErrorInfo{Reason: ReasonValidationFailed, Domain: o.errorDomain},
+		badRequest,
+	)
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// jsonFieldName converts the Go field name reported by protoc-gen-validate
+// (e.g. "FullName") into the name clients see in JSON ("fullName").
+func jsonFieldName(field string) string {
+	r, size := utf8.DecodeRuneInString(field)
+	if r == utf8.RuneError {
+		return field
+	}
+	return string(unicode.ToLower(r)) + field[size:]
+}
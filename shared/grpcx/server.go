@@ -0,0 +1,204 @@
+package grpcx
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"ms-ride-sharing/shared/authz"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type options struct {
+	defaultTimeout time.Duration
+	maxTimeout     time.Duration
+	errorMappings  []ErrorMapping
+	errorDomain    string
+	quietPrefixes  []string
+	authz          *authz.Registry
+	identities     *authz.Verifier
+}
+
+type Option func(*options)
+
+// WithDefaultTimeout sets the deadline applied to unary calls that arrive
+// without one.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.defaultTimeout = d
+	}
+}
+
+// WithMaxTimeout caps the deadline a caller can ask for on unary calls.
+func WithMaxTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.maxTimeout = d
+	}
+}
+
+// WithErrorMappings registers the domain errors translated to status codes.
+func WithErrorMappings(mappings ...ErrorMapping) Option {
+	return func(o *options) {
+		o.errorMappings = append(o.errorMappings, mappings...)
+	}
+}
+
+// WithErrorDomain sets the ErrorInfo domain, usually the service name.
+func WithErrorDomain(domain string) Option {
+	return func(o *options) {
+		o.errorDomain = domain
+	}
+}
+
+// ServerOptions builds the interceptor chain shared by every gRPC service.
+// The order matters: request ID first so every other step can log it,
+// recovery right after so panics anywhere below are caught, and error
+// translation last so it sees what the handler returned.
+func ServerOptions(opts ...Option) []grpc.ServerOption {
+	o := &options{
+		defaultTimeout: 10 * time.Second,
+		maxTimeout:     30 * time.Second,
+		quietPrefixes:  []string{"/grpc.health.v1.Health/"},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			unaryRequestID,
+			o.unaryLogging,
+			o.unaryRecovery,
+			o.unaryDeadline,
+			o.unaryAuth,
+			o.unaryValidate,
+			o.unaryErrors,
+		),
+		grpc.ChainStreamInterceptor(
+			streamRequestID,
+			o.streamLogging,
+			o.streamRecovery,
+			o.streamAuth,
+			o.streamValidate,
+			o.streamErrors,
+		),
+	}
+}
+
+func unaryRequestID(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(requestIDFromIncoming(ctx), req)
+}
+
+func streamRequestID(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: requestIDFromIncoming(ss.Context())})
+}
+
+func (o *options) unaryLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	o.logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func (o *options) streamLogging(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	o.logCall(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+func (o *options) logCall(ctx context.Context, method string, start time.Time, err error) {
+	for _, prefix := range o.quietPrefixes {
+		if strings.HasPrefix(method, prefix) && err == nil {
+			return
+		}
+	}
+
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	case codes.Unavailable, codes.DeadlineExceeded:
+		level = slog.LevelWarn
+	}
+
+	slog.Log(ctx, level, "grpc call",
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
+
+func (o *options) unaryRecovery(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = o.recovered(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (o *options) streamRecovery(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = o.recovered(ss.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func (o *options) recovered(ctx context.Context, method string, r any) error {
+	slog.ErrorContext(ctx, "panic recovered",
+		slog.String("method", method),
+		slog.Any("panic", r),
+		slog.String("stack", string(debug.Stack())),
+	)
+	return o.internalError()
+}
+
+// unaryDeadline gives calls without a deadline the default one and shortens
+// deadlines longer than the maximum. Streams are left alone since they are
+// expected to be long-lived.
+func (o *options) unaryDeadline(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	deadline, ok := ctx.Deadline()
+	switch {
+	case !ok && o.defaultTimeout > 0:
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.defaultTimeout)
+		defer cancel()
+	case ok && o.maxTimeout > 0 && time.Until(deadline) > o.maxTimeout:
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.maxTimeout)
+		defer cancel()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	return handler(ctx, req)
+}
+
+func (o *options) unaryErrors(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, o.translateError(ctx, info.FullMethod, err)
+}
+
+func (o *options) streamErrors(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return o.translateError(ss.Context(), info.FullMethod, handler(srv, ss))
+}
+
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
@@ -0,0 +1,55 @@
+package grpcx
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// Messages generated by protoc-gen-validate implement both interfaces;
+// ValidateAll is preferred so the caller gets every violation at once.
+type allValidator interface {
+	ValidateAll() error
+}
+
+type validator interface {
+	Validate() error
+}
+
+func (o *options) validate(msg any) error {
+	var err error
+	switch m := msg.(type) {
+	case allValidator:
+		err = m.ValidateAll()
+	case validator:
+		err = m.Validate()
+	}
+
+	if err != nil {
+		return o.validationError(err)
+	}
+	return nil
+}
+
+func (o *options) unaryValidate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := o.validate(req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (o *options) streamValidate(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validatingStream{ServerStream: ss, opts: o})
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+	opts *options
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.opts.validate(m)
+}
@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// BindGRPC keeps the serving status of the overall server ("") and of the
+// given services in sync with the monitor. Everything starts as NOT_SERVING
+// until the first round of checks passes.
+func BindGRPC(m *Monitor, srv *health.Server, services ...string) {
+	names := append([]string{""}, services...)
+
+	set := func(healthy bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if healthy {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		for _, name := range names {
+			srv.SetServingStatus(name, status)
+		}
+	}
+
+	set(false)
+	m.OnChange(set)
+}
+
+// GRPCConnCheck reports whether conn can reach its upstream. An idle
+// connection is kicked and given the check timeout to become ready.
+func GRPCConnCheck(name string, conn *grpc.ClientConn) Check {
+	return Check{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			for {
+				state := conn.GetState()
+				switch state {
+				case connectivity.Ready:
+					return nil
+				case connectivity.Idle:
+					conn.Connect()
+				case connectivity.Shutdown:
+					return fmt.Errorf("connection is shut down")
+				}
+
+				if !conn.WaitForStateChange(ctx, state) {
+					return fmt.Errorf("upstream not ready: %s", strings.ToLower(state.String()))
+				}
+			}
+		},
+	}
+}
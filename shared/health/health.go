@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultTimeout = 2 * time.Second
+
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named dependency probe, e.g. a database or Redis ping.
+type Check struct {
+	Name    string
+	Check   CheckFunc
+	Timeout time.Duration
+}
+
+// Status is the result of the last run of a Check.
+type Status struct {
+	Name      string        `json:"name"`
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency"`
+	LastError string        `json:"last_error,omitempty"`
+	// LastErrorAt is kept after the dependency recovers, for diagnostics.
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	type alias Status
+	return json.Marshal(struct {
+		alias
+		Latency string `json:"latency"`
+	}{alias: alias(s), Latency: s.Latency.String()})
+}
+
+// Monitor runs every check periodically and keeps their last status, so
+// probes read a cached answer instead of hitting the dependencies.
+type Monitor struct {
+	interval time.Duration
+	checks   []Check
+
+	mu        sync.RWMutex
+	statuses  map[string]Status
+	healthy   bool
+	listeners []func(healthy bool)
+}
+
+func NewMonitor(interval time.Duration, checks ...Check) *Monitor {
+	return &Monitor{
+		interval: interval,
+		checks:   checks,
+		statuses: make(map[string]Status, len(checks)),
+	}
+}
+
+// OnChange registers fn to be called every time the aggregated health flips.
+func (m *Monitor) OnChange(fn func(healthy bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listeners = append(m.listeners, fn)
+}
+
+// Run checks right away and then on every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	m.RunOnce(ctx)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.RunOnce(ctx)
+		}
+	}
+}
+
+// RunOnce runs every check concurrently and updates the cached statuses.
+func (m *Monitor) RunOnce(ctx context.Context) {
+	results := make([]Status, len(m.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range m.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	healthy := true
+	for _, status := range results {
+		healthy = healthy && status.Healthy
+	}
+
+	m.mu.Lock()
+	for _, status := range results {
+		prev, ok := m.statuses[status.Name]
+		if status.Healthy && ok {
+			status.LastError, status.LastErrorAt = prev.LastError, prev.LastErrorAt
+		}
+		if ok && prev.Healthy != status.Healthy {
+			if status.Healthy {
+				slog.Info("health check recovered", slog.String("check", status.Name))
+			} else {
+				slog.Warn("health check failing", slog.String("check", status.Name), slog.String("error", status.LastError))
+			}
+		}
+		m.statuses[status.Name] = status
+	}
+	changed := m.healthy != healthy
+	m.healthy = healthy
+	listeners := m.listeners
+	m.mu.Unlock()
+
+	if changed {
+		for _, fn := range listeners {
+			fn(healthy)
+		}
+	}
+}
+
+// Healthy reports whether every check passed on its last run.
+func (m *Monitor) Healthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.healthy
+}
+
+// Statuses returns the last status of every check, in registration order.
+func (m *Monitor) Statuses() []Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make([]Status, 0, len(m.checks))
+	for _, check := range m.checks {
+		if status, ok := m.statuses[check.Name]; ok {
+			out = append(out, status)
+		} else {
+			out = append(out, Status{Name: check.Name})
+		}
+	}
+	return out
+}
+
+func run(ctx context.Context, check Check) Status {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+
+	status := Status{
+		Name:      check.Name,
+		Healthy:   err == nil,
+		Latency:   time.Since(start),
+		CheckedAt: start,
+	}
+	if err != nil {
+		status.LastError = err.Error()
+		status.LastErrorAt = &start
+	}
+	return status
+}
+
+func RedisCheck(rdb *redis.Client) Check {
+	return Check{
+		Name: "redis",
+		Check: func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		},
+	}
+}
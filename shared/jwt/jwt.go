@@ -2,6 +2,7 @@ package jwt
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -18,11 +19,30 @@ const (
 )
 
 type JWTService struct {
-	secret []byte
+	secret            []byte
+	accessExpiration  atomic.Int64
+	refreshExpiration atomic.Int64
 }
 
 func NewJWTService(secret string) *JWTService {
-	return &JWTService{secret: []byte(secret)}
+	svc := &JWTService{secret: []byte(secret)}
+	svc.SetExpirations(ACCESS_EXPIRATION, REFRESH_EXPIRATION)
+	return svc
+}
+
+// SetExpirations changes the lifetime of tokens issued from now on. It is safe
+// to call while tokens are being generated.
+func (j *JWTService) SetExpirations(access, refresh time.Duration) {
+	j.accessExpiration.Store(int64(access))
+	j.refreshExpiration.Store(int64(refresh))
+}
+
+func (j *JWTService) AccessExpiration() time.Duration {
+	return time.Duration(j.accessExpiration.Load())
+}
+
+func (j *JWTService) RefreshExpiration() time.Duration {
+	return time.Duration(j.refreshExpiration.Load())
 }
 
 type TokenResponse struct {
@@ -30,14 +50,16 @@ type TokenResponse struct {
 	JTI         string
 }
 
-func (j *JWTService) GenerateToken(userID string, tokenType tokenType) (*TokenResponse, error) {
+// GenerateToken issues a token for userID. role is the user type, which the
+// gateway checks against route policies.
+func (j *JWTService) GenerateToken(userID, role string, tokenType tokenType) (*TokenResponse, error) {
 	var exp int64
 
 	switch tokenType {
 	case ACCESS:
-		exp = time.Now().Add(ACCESS_EXPIRATION).Unix()
+		exp = time.Now().Add(j.AccessExpiration()).Unix()
 	case REFRESH:
-		exp = time.Now().Add(REFRESH_EXPIRATION).Unix()
+		exp = time.Now().Add(j.RefreshExpiration()).Unix()
 	default:
 		return nil, fmt.Errorf("invalid token type")
 	}
@@ -46,6 +68,7 @@ func (j *JWTService) GenerateToken(userID string, tokenType tokenType) (*TokenRe
 
 	claims := jwt.MapClaims{
 		"sub":  userID,
+		"role": role,
 		"jti":  jti,
 		"type": string(tokenType),
 		"exp":  exp,
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"ms-ride-sharing/shared/requestid"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values never reach the output, no
+// matter which group they are logged under.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"password":      true,
+	"email":         true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"jwt_secret":    true,
+	"secret":        true,
+	"ticket":        true,
+	"cookie":        true,
+}
+
+var level = new(slog.LevelVar)
+
+// Setup installs a JSON logger as the slog default, which also routes the
+// standard log package through it. Every line carries the service name and,
+// when logged with a context, the request ID and context attributes.
+func Setup(service, environment string) *slog.Logger {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+
+	l := slog.New(&contextHandler{Handler: handler}).With(
+		slog.String("service", service),
+		slog.String("environment", environment),
+	)
+	slog.SetDefault(l)
+	return l
+}
+
+// SetLevel changes the minimum level of the logger installed by Setup.
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// Fatal logs at error level and exits, the slog counterpart of log.Fatalf.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+type attrsKey struct{}
+
+// attrs is a mutable list so middleware further down the chain (e.g. auth)
+// can add attributes seen by handlers further up (e.g. the access log).
+type attrs struct {
+	mu   sync.Mutex
+	list []slog.Attr
+}
+
+// WithAttrs returns a context whose log lines include the given attributes.
+// If ctx already carries attributes from this package, they are extended in
+// place so loggers holding the parent context see them too.
+func WithAttrs(ctx context.Context, args ...slog.Attr) context.Context {
+	if existing, ok := ctx.Value(attrsKey{}).(*attrs); ok {
+		existing.mu.Lock()
+		existing.list = append(existing.list, args...)
+		existing.mu.Unlock()
+		return ctx
+	}
+	return context.WithValue(ctx, attrsKey{}, &attrs{list: args})
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if a, ok := ctx.Value(attrsKey{}).(*attrs); ok {
+		a.mu.Lock()
+		r.AddAttrs(a.list...)
+		a.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(as)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Err is a shorthand for the attribute used to log errors.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
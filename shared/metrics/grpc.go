@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, by method and status code.",
+	}, []string{"grpc_service", "grpc_method", "grpc_type", "grpc_code"})
+
+	grpcHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Latency of RPCs handled by the server, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_service", "grpc_method", "grpc_type"})
+)
+
+// GRPCServerOptions returns interceptors that record request count and
+// latency of every RPC broken down by service, method and status code.
+func GRPCServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryServerMetrics),
+		grpc.ChainStreamInterceptor(streamServerMetrics),
+	}
+}
+
+func unaryServerMetrics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, "unary", start, err)
+	return resp, err
+}
+
+func streamServerMetrics(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+
+	rpcType := "bidi_stream"
+	switch {
+	case info.IsClientStream && !info.IsServerStream:
+		rpcType = "client_stream"
+	case !info.IsClientStream && info.IsServerStream:
+		rpcType = "server_stream"
+	}
+
+	observeRPC(info.FullMethod, rpcType, start, err)
+	return err
+}
+
+func observeRPC(fullMethod, rpcType string, start time.Time, err error) {
+	service, method := splitMethod(fullMethod)
+	grpcHandled.WithLabelValues(service, method, rpcType, status.Code(err).String()).Inc()
+	grpcHandlingSeconds.WithLabelValues(service, method, rpcType).Observe(time.Since(start).Seconds())
+}
+
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", "unknown"
+	}
+	return service, method
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Handler serves every metric registered on the default registry.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDBPool exports the connection pool stats of db (open, in use,
+// idle, wait count and duration) labelled with name.
+func RegisterDBPool(name string, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return prometheus.Register(collectors.NewDBStatsCollector(sqlDB, name))
+}
+
+// RegisterRedisPool exports the connection pool stats of rdb labelled with name.
+func RegisterRedisPool(name string, rdb *redis.Client) error {
+	return prometheus.Register(&redisPoolCollector{name: name, rdb: rdb})
+}
+
+var (
+	redisPoolConns = prometheus.NewDesc(
+		"redis_pool_connections",
+		"Number of connections in the Redis pool by state.",
+		[]string{"client", "state"}, nil,
+	)
+	redisPoolEvents = prometheus.NewDesc(
+		"redis_pool_events_total",
+		"Redis pool lookups by outcome (hit, miss, timeout).",
+		[]string{"client", "outcome"}, nil,
+	)
+)
+
+type redisPoolCollector struct {
+	name string
+	rdb  *redis.Client
+}
+
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisPoolConns
+	ch <- redisPoolEvents
+}
+
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.rdb.PoolStats()
+
+	ch <- prometheus.MustNewConstMetric(redisPoolConns, prometheus.GaugeValue, float64(stats.TotalConns), c.name, "total")
+	ch <- prometheus.MustNewConstMetric(redisPoolConns, prometheus.GaugeValue, float64(stats.IdleConns), c.name, "idle")
+	ch <- prometheus.MustNewConstMetric(redisPoolConns, prometheus.GaugeValue, float64(stats.StaleConns), c.name, "stale")
+
+	ch <- prometheus.MustNewConstMetric(redisPoolEvents, prometheus.CounterValue, float64(stats.Hits), c.name, "hit")
+	ch <- prometheus.MustNewConstMetric(redisPoolEvents, prometheus.CounterValue, float64(stats.Misses), c.name, "miss")
+	ch <- prometheus.MustNewConstMetric(redisPoolEvents, prometheus.CounterValue, float64(stats.Timeouts), c.name, "timeout")
+}
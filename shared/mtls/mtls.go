@@ -0,0 +1,240 @@
+package mtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/credentials"
+)
+
+var certExpiry = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "tls_certificate_expiry_timestamp_seconds",
+	Help: "Expiry of the loaded TLS certificate, as a Unix timestamp.",
+}, []string{"subject"})
+
+// Config points at PEM files, usually mounted from a Kubernetes secret.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// CAFile holds the roots that peer certificates must chain to.
+	CAFile string
+}
+
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c Config) Validate() error {
+	if c.CertFile == "" && c.KeyFile == "" && c.CAFile == "" {
+		return nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" || c.CAFile == "" {
+		return errors.New("cert, key and ca files must be set together")
+	}
+	return nil
+}
+
+type material struct {
+	cert  *tls.Certificate
+	roots *x509.CertPool
+}
+
+// Source holds the current certificate and CA pool and swaps them when the
+// files change, so rotated certificates are used by new handshakes without a
+// restart. Established connections keep the certificate they started with.
+type Source struct {
+	cfg     Config
+	current atomic.Pointer[material]
+
+	mu   sync.Mutex
+	hash [sha256.Size]byte
+}
+
+// NewSource loads the files once; a broken certificate is a startup error.
+func NewSource(cfg Config) (*Source, error) {
+	s := &Source{cfg: cfg}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the files and swaps them in when they changed. On failure the
+// previous certificate stays in use.
+func (s *Source) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var contents [3][]byte
+	for i, path := range []string{s.cfg.CertFile, s.cfg.KeyFile, s.cfg.CAFile} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		contents[i] = content
+	}
+
+	hash := sha256.Sum256(bytes.Join(contents[:], nil))
+	if hash == s.hash {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(contents[0], contents[1])
+	if err != nil {
+		return fmt.Errorf("loading key pair: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(contents[2]) {
+		return fmt.Errorf("no certificates found in %s", s.cfg.CAFile)
+	}
+
+	leaf := cert.Leaf
+	certExpiry.WithLabelValues(leaf.Subject.CommonName).Set(float64(leaf.NotAfter.Unix()))
+
+	first := s.current.Load() == nil
+	s.current.Store(&material{cert: &cert, roots: roots})
+	s.hash = hash
+
+	if !first {
+		slog.Info("tls certificates reloaded",
+			slog.String("subject", leaf.Subject.CommonName),
+			slog.Time("not_after", leaf.NotAfter),
+		)
+	}
+	return nil
+}
+
+// Watch polls the files every interval until ctx is done. Like the runtime
+// config, polling survives the symlink swap of a secret volume.
+func (s *Source) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				slog.Warn("tls reload failed, keeping current certificates", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// ServerCredentials require a client certificate signed by the CA. When
+// allowedPeers is not empty the client must also present one of those
+// identities (see PeerAllowed).
+func (s *Source) ServerCredentials(allowedPeers []string) credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.current.Load().cert, nil
+		},
+		// The chain is checked in VerifyPeerCertificate against the current
+		// CA pool, which a static ClientCAs could not follow across reloads.
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: s.verify(x509.ExtKeyUsageClientAuth, "", allowedPeers),
+	})
+}
+
+// ClientCredentials present the current certificate and verify the server
+// against the CA. The server must match allowedPeers when given, or else
+// serverName.
+func (s *Source) ClientCredentials(serverName string, allowedPeers []string) credentials.TransportCredentials {
+	return credentials.NewTLS(s.ClientConfig(serverName, allowedPeers))
+}
+
+// ClientConfig is ClientCredentials for plain TLS clients, such as the
+// WebSocket proxy.
+func (s *Source) ClientConfig(serverName string, allowedPeers []string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.current.Load().cert, nil
+		},
+		// Verification is done in VerifyPeerCertificate with the current CA
+		// pool and identity rules; it is not skipped.
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: s.verify(x509.ExtKeyUsageServerAuth, serverName, allowedPeers),
+	}
+}
+
+func (s *Source) verify(usage x509.ExtKeyUsage, serverName string, allowedPeers []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("peer sent no certificate")
+		}
+
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("parsing peer certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		leaf := certs[0]
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         s.current.Load().roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		})
+		if err != nil {
+			return fmt.Errorf("verifying peer certificate: %w", err)
+		}
+
+		if len(allowedPeers) > 0 {
+			if !PeerAllowed(leaf, allowedPeers) {
+				return fmt.Errorf("peer %v is not allowed", Identities(leaf))
+			}
+			return nil
+		}
+		if serverName != "" {
+			return leaf.VerifyHostname(serverName)
+		}
+		return nil
+	}
+}
+
+// Identities returns the URI SANs of cert (SPIFFE IDs, e.g.
+// spiffe://ride-sharing.local/api-gateway) followed by its common name.
+func Identities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// PeerAllowed reports whether one of the identities of cert is in allowed.
+func PeerAllowed(cert *x509.Certificate, allowed []string) bool {
+	for _, id := range Identities(cert) {
+		if slices.Contains(allowed, id) {
+			return true
+		}
+	}
+	return false
+}
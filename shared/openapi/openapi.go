@@ -0,0 +1,9 @@
+// Package openapi embeds the OpenAPI (Swagger 2.0) documents generated from
+// the protos by `make generate-types`, one per proto file, e.g.
+// user/user.swagger.json for user/user.proto.
+package openapi
+
+import "embed"
+
+//go:embed */*.swagger.json
+var Specs embed.FS
@@ -0,0 +1,159 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: ridesharing/auth.proto
+
+package ridesharing
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// AuthRule declara quem pode chamar um RPC. RPCs sem a opção exigem um
+// usuário autenticado de qualquer tipo.
+type AuthRule struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// public libera o RPC sem token de acesso.
+	Public bool `protobuf:"varint,1,opt,name=public,proto3" json:"public,omitempty"`
+	// roles restringe o RPC a estes tipos de usuário (ex.: DRIVER); vazio
+	// aceita qualquer usuário autenticado.
+	Roles         []string `protobuf:"bytes,2,rep,name=roles,proto3" json:"roles,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthRule) Reset() {
+	*x = AuthRule{}
+	mi := &file_ridesharing_auth_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthRule) ProtoMessage() {}
+
+func (x *AuthRule) ProtoReflect() protoreflect.Message {
+	mi := &file_ridesharing_auth_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthRule.ProtoReflect.Descriptor instead.
+func (*AuthRule) Descriptor() ([]byte, []int) {
+	return file_ridesharing_auth_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *AuthRule) GetPublic() bool {
+	if x != nil {
+		return x.Public
+	}
+	return false
+}
+
+func (x *AuthRule) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+var file_ridesharing_auth_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*AuthRule)(nil),
+		Field:         50100,
+		Name:          "ridesharing.auth",
+		Tag:           "bytes,50100,opt,name=auth",
+		Filename:      "ridesharing/auth.proto",
+	},
+}
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// optional ridesharing.AuthRule auth = 50100;
+	E_Auth = &file_ridesharing_auth_proto_extTypes[0]
+)
+
+var File_ridesharing_auth_proto protoreflect.FileDescriptor
+
+const file_ridesharing_auth_proto_rawDesc = "" +
+	"\n" +
+	"\x16ridesharing/auth.proto\x12\vridesharing\x1a google/protobuf/descriptor.proto\"8\n" +
+	"\bAuthRule\x12\x16\n" +
+	"\x06public\x18\x01 \x01(\bR\x06public\x12\x14\n" +
+	"\x05roles\x18\x02 \x03(\tR\x05roles:K\n" +
+	"\x04auth\x12\x1e.google.protobuf.MethodOptions\x18\xb4\x87\x03 \x01(\v2\x15.ridesharing.AuthRuleR\x04authB9Z7ms-ride-sharing/shared/proto/v1/ridesharing;ridesharingb\x06proto3"
+
+var (
+	file_ridesharing_auth_proto_rawDescOnce sync.Once
+	file_ridesharing_auth_proto_rawDescData []byte
+)
+
+func file_ridesharing_auth_proto_rawDescGZIP() []byte {
+	file_ridesharing_auth_proto_rawDescOnce.Do(func() {
+		file_ridesharing_auth_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ridesharing_auth_proto_rawDesc), len(file_ridesharing_auth_proto_rawDesc)))
+	})
+	return file_ridesharing_auth_proto_rawDescData
+}
+
+var file_ridesharing_auth_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_ridesharing_auth_proto_goTypes = []any{
+	(*AuthRule)(nil),                   // 0: ridesharing.AuthRule
+	(*descriptorpb.MethodOptions)(nil), // 1: google.protobuf.MethodOptions
+}
+var file_ridesharing_auth_proto_depIdxs = []int32{
+	1, // 0: ridesharing.auth:extendee -> google.protobuf.MethodOptions
+	0, // 1: ridesharing.auth:type_name -> ridesharing.AuthRule
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	1, // [1:2] is the sub-list for extension type_name
+	0, // [0:1] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_ridesharing_auth_proto_init() }
+func file_ridesharing_auth_proto_init() {
+	if File_ridesharing_auth_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ridesharing_auth_proto_rawDesc), len(file_ridesharing_auth_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 1,
+			NumServices:   0,
+		},
+		GoTypes:           file_ridesharing_auth_proto_goTypes,
+		DependencyIndexes: file_ridesharing_auth_proto_depIdxs,
+		MessageInfos:      file_ridesharing_auth_proto_msgTypes,
+		ExtensionInfos:    file_ridesharing_auth_proto_extTypes,
+	}.Build()
+	File_ridesharing_auth_proto = out.File
+	file_ridesharing_auth_proto_goTypes = nil
+	file_ridesharing_auth_proto_depIdxs = nil
+}
@@ -11,6 +11,7 @@ import (
 	_ "google.golang.org/genproto/googleapis/api/annotations"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	_ "ms-ride-sharing/shared/proto/v1/ridesharing"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -496,11 +497,99 @@ func (x *RefreshTokenResponse) GetRefreshToken() string {
 	return ""
 }
 
+type CreateWebSocketTicketRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateWebSocketTicketRequest) Reset() {
+	*x = CreateWebSocketTicketRequest{}
+	mi := &file_user_user_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWebSocketTicketRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWebSocketTicketRequest) ProtoMessage() {}
+
+func (x *CreateWebSocketTicketRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_user_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWebSocketTicketRequest.ProtoReflect.Descriptor instead.
+func (*CreateWebSocketTicketRequest) Descriptor() ([]byte, []int) {
+	return file_user_user_proto_rawDescGZIP(), []int{8}
+}
+
+type CreateWebSocketTicketResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Ticket           string                 `protobuf:"bytes,1,opt,name=ticket,proto3" json:"ticket,omitempty"`
+	ExpiresInSeconds int32                  `protobuf:"varint,2,opt,name=expires_in_seconds,json=expiresInSeconds,proto3" json:"expires_in_seconds,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *CreateWebSocketTicketResponse) Reset() {
+	*x = CreateWebSocketTicketResponse{}
+	mi := &file_user_user_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateWebSocketTicketResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateWebSocketTicketResponse) ProtoMessage() {}
+
+func (x *CreateWebSocketTicketResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_user_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateWebSocketTicketResponse.ProtoReflect.Descriptor instead.
+func (*CreateWebSocketTicketResponse) Descriptor() ([]byte, []int) {
+	return file_user_user_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CreateWebSocketTicketResponse) GetTicket() string {
+	if x != nil {
+		return x.Ticket
+	}
+	return ""
+}
+
+func (x *CreateWebSocketTicketResponse) GetExpiresInSeconds() int32 {
+	if x != nil {
+		return x.ExpiresInSeconds
+	}
+	return 0
+}
+
 var File_user_user_proto protoreflect.FileDescriptor
 
 const file_user_user_proto_rawDesc = "" +
 	"\n" +
-	"\x0fuser/user.proto\x12\x0eridesharing.v1\x1a\x1cgoogle/api/annotations.proto\x1a\x17validate/validate.proto\"\xbe\x01\n" +
+	"\x0fuser/user.proto\x12\x0eridesharing.v1\x1a\x1cgoogle/api/annotations.proto\x1a\x17validate/validate.proto\x1a\x16ridesharing/auth.proto\"\xbe\x01\n" +
 	"\x11CreateUserRequest\x12$\n" +
 	"\tfull_name\x18\x01 \x01(\tB\a\xfaB\x04r\x02\x10\x02R\bfullName\x12\x1d\n" +
 	"\x05email\x18\x02 \x01(\tB\a\xfaB\x04r\x02`\x01R\x05email\x12#\n" +
@@ -525,18 +614,23 @@ const file_user_user_proto_rawDesc = "" +
 	"\x05token\x18\x01 \x01(\tR\x05token\"^\n" +
 	"\x14RefreshTokenResponse\x12!\n" +
 	"\faccess_token\x18\x01 \x01(\tR\vaccessToken\x12#\n" +
-	"\rrefresh_token\x18\x02 \x01(\tR\frefreshToken*2\n" +
+	"\rrefresh_token\x18\x02 \x01(\tR\frefreshToken\"\x1e\n" +
+	"\x1cCreateWebSocketTicketRequest\"e\n" +
+	"\x1dCreateWebSocketTicketResponse\x12\x16\n" +
+	"\x06ticket\x18\x01 \x01(\tR\x06ticket\x12,\n" +
+	"\x12expires_in_seconds\x18\x02 \x01(\x05R\x10expiresInSeconds*2\n" +
 	"\bUserType\x12\x0f\n" +
 	"\vUNSPECIFIED\x10\x00\x12\t\n" +
 	"\x05RIDER\x10\x01\x12\n" +
 	"\n" +
-	"\x06DRIVER\x10\x022\xd0\x03\n" +
-	"\vUserService\x12m\n" +
+	"\x06DRIVER\x10\x022\xff\x04\n" +
+	"\vUserService\x12s\n" +
 	"\n" +
-	"CreateUser\x12!.ridesharing.v1.CreateUserRequest\x1a\".ridesharing.v1.CreateUserResponse\"\x18\x82\xd3\xe4\x93\x02\x12:\x01*\"\r/api/v1/users\x12d\n" +
-	"\x05Login\x12\x1c.ridesharing.v1.LoginRequest\x1a\x1d.ridesharing.v1.LoginResponse\"\x1e\x82\xd3\xe4\x93\x02\x18:\x01*\"\x13/api/v1/users/login\x12h\n" +
-	"\x06Logout\x12\x1d.ridesharing.v1.LogoutRequest\x1a\x1e.ridesharing.v1.LogoutResponse\"\x1f\x82\xd3\xe4\x93\x02\x19:\x01*\"\x14/api/v1/users/logout\x12\x81\x01\n" +
-	"\fRefreshToken\x12#.ridesharing.v1.RefreshTokenRequest\x1a$.ridesharing.v1.RefreshTokenResponse\"&\x82\xd3\xe4\x93\x02 :\x01*\"\x1b/api/v1/users/refresh-tokenB(Z&ms-ride-sharing/shared/proto/user;userb\x06proto3"
+	"CreateUser\x12!.ridesharing.v1.CreateUserRequest\x1a\".ridesharing.v1.CreateUserResponse\"\x1e\xa2\xbb\x18\x02\b\x01\x82\xd3\xe4\x93\x02\x12:\x01*\"\r/api/v1/users\x12j\n" +
+	"\x05Login\x12\x1c.ridesharing.v1.LoginRequest\x1a\x1d.ridesharing.v1.LoginResponse\"$\xa2\xbb\x18\x02\b\x01\x82\xd3\xe4\x93\x02\x18:\x01*\"\x13/api/v1/users/login\x12k\n" +
+	"\x06Logout\x12\x1d.ridesharing.v1.LogoutRequest\x1a\x1e.ridesharing.v1.LogoutResponse\"\"\x82\xd3\xe4\x93\x02\x19:\x01*\"\x14/api/v1/users/logout\x90\x02\x02\x12\x87\x01\n" +
+	"\fRefreshToken\x12#.ridesharing.v1.RefreshTokenRequest\x1a$.ridesharing.v1.RefreshTokenResponse\",\xa2\xbb\x18\x02\b\x01\x82\xd3\xe4\x93\x02 :\x01*\"\x1b/api/v1/users/refresh-token\x12\x97\x01\n" +
+	"\x15CreateWebSocketTicket\x12,.ridesharing.v1.CreateWebSocketTicketRequest\x1a-.ridesharing.v1.CreateWebSocketTicketResponse\"!\x82\xd3\xe4\x93\x02\x1b:\x01*\"\x16/api/v1/auth/ws-ticketB(Z&ms-ride-sharing/shared/proto/user;userb\x06proto3"
 
 var (
 	file_user_user_proto_rawDescOnce sync.Once
@@ -551,34 +645,38 @@ func file_user_user_proto_rawDescGZIP() []byte {
 }
 
 var file_user_user_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_user_user_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_user_user_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_user_user_proto_goTypes = []any{
-	(UserType)(0),                // 0: ridesharing.v1.UserType
-	(*CreateUserRequest)(nil),    // 1: ridesharing.v1.CreateUserRequest
-	(*CreateUserResponse)(nil),   // 2: ridesharing.v1.CreateUserResponse
-	(*LoginRequest)(nil),         // 3: ridesharing.v1.LoginRequest
-	(*LoginResponse)(nil),        // 4: ridesharing.v1.LoginResponse
-	(*LogoutRequest)(nil),        // 5: ridesharing.v1.LogoutRequest
-	(*LogoutResponse)(nil),       // 6: ridesharing.v1.LogoutResponse
-	(*RefreshTokenRequest)(nil),  // 7: ridesharing.v1.RefreshTokenRequest
-	(*RefreshTokenResponse)(nil), // 8: ridesharing.v1.RefreshTokenResponse
+	(UserType)(0),                         // 0: ridesharing.v1.UserType
+	(*CreateUserRequest)(nil),             // 1: ridesharing.v1.CreateUserRequest
+	(*CreateUserResponse)(nil),            // 2: ridesharing.v1.CreateUserResponse
+	(*LoginRequest)(nil),                  // 3: ridesharing.v1.LoginRequest
+	(*LoginResponse)(nil),                 // 4: ridesharing.v1.LoginResponse
+	(*LogoutRequest)(nil),                 // 5: ridesharing.v1.LogoutRequest
+	(*LogoutResponse)(nil),                // 6: ridesharing.v1.LogoutResponse
+	(*RefreshTokenRequest)(nil),           // 7: ridesharing.v1.RefreshTokenRequest
+	(*RefreshTokenResponse)(nil),          // 8: ridesharing.v1.RefreshTokenResponse
+	(*CreateWebSocketTicketRequest)(nil),  // 9: ridesharing.v1.CreateWebSocketTicketRequest
+	(*CreateWebSocketTicketResponse)(nil), // 10: ridesharing.v1.CreateWebSocketTicketResponse
 }
 var file_user_user_proto_depIdxs = []int32{
-	0, // 0: ridesharing.v1.CreateUserRequest.user_type:type_name -> ridesharing.v1.UserType
-	0, // 1: ridesharing.v1.LoginResponse.type:type_name -> ridesharing.v1.UserType
-	1, // 2: ridesharing.v1.UserService.CreateUser:input_type -> ridesharing.v1.CreateUserRequest
-	3, // 3: ridesharing.v1.UserService.Login:input_type -> ridesharing.v1.LoginRequest
-	5, // 4: ridesharing.v1.UserService.Logout:input_type -> ridesharing.v1.LogoutRequest
-	7, // 5: ridesharing.v1.UserService.RefreshToken:input_type -> ridesharing.v1.RefreshTokenRequest
-	2, // 6: ridesharing.v1.UserService.CreateUser:output_type -> ridesharing.v1.CreateUserResponse
-	4, // 7: ridesharing.v1.UserService.Login:output_type -> ridesharing.v1.LoginResponse
-	6, // 8: ridesharing.v1.UserService.Logout:output_type -> ridesharing.v1.LogoutResponse
-	8, // 9: ridesharing.v1.UserService.RefreshToken:output_type -> ridesharing.v1.RefreshTokenResponse
-	6, // [6:10] is the sub-list for method output_type
-	2, // [2:6] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	0,  // 0: ridesharing.v1.CreateUserRequest.user_type:type_name -> ridesharing.v1.UserType
+	0,  // 1: ridesharing.v1.LoginResponse.type:type_name -> ridesharing.v1.UserType
+	1,  // 2: ridesharing.v1.UserService.CreateUser:input_type -> ridesharing.v1.CreateUserRequest
+	3,  // 3: ridesharing.v1.UserService.Login:input_type -> ridesharing.v1.LoginRequest
+	5,  // 4: ridesharing.v1.UserService.Logout:input_type -> ridesharing.v1.LogoutRequest
+	7,  // 5: ridesharing.v1.UserService.RefreshToken:input_type -> ridesharing.v1.RefreshTokenRequest
+	9,  // 6: ridesharing.v1.UserService.CreateWebSocketTicket:input_type -> ridesharing.v1.CreateWebSocketTicketRequest
+	2,  // 7: ridesharing.v1.UserService.CreateUser:output_type -> ridesharing.v1.CreateUserResponse
+	4,  // 8: ridesharing.v1.UserService.Login:output_type -> ridesharing.v1.LoginResponse
+	6,  // 9: ridesharing.v1.UserService.Logout:output_type -> ridesharing.v1.LogoutResponse
+	8,  // 10: ridesharing.v1.UserService.RefreshToken:output_type -> ridesharing.v1.RefreshTokenResponse
+	10, // 11: ridesharing.v1.UserService.CreateWebSocketTicket:output_type -> ridesharing.v1.CreateWebSocketTicketResponse
+	7,  // [7:12] is the sub-list for method output_type
+	2,  // [2:7] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_user_user_proto_init() }
@@ -592,7 +690,7 @@ func file_user_user_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_user_user_proto_rawDesc), len(file_user_user_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   8,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,10 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	UserService_CreateUser_FullMethodName   = "/ridesharing.v1.UserService/CreateUser"
-	UserService_Login_FullMethodName        = "/ridesharing.v1.UserService/Login"
-	UserService_Logout_FullMethodName       = "/ridesharing.v1.UserService/Logout"
-	UserService_RefreshToken_FullMethodName = "/ridesharing.v1.UserService/RefreshToken"
+	UserService_CreateUser_FullMethodName            = "/ridesharing.v1.UserService/CreateUser"
+	UserService_Login_FullMethodName                 = "/ridesharing.v1.UserService/Login"
+	UserService_Logout_FullMethodName                = "/ridesharing.v1.UserService/Logout"
+	UserService_RefreshToken_FullMethodName          = "/ridesharing.v1.UserService/RefreshToken"
+	UserService_CreateWebSocketTicket_FullMethodName = "/ridesharing.v1.UserService/CreateWebSocketTicket"
 )
 
 // UserServiceClient is the client API for UserService service.
@@ -37,6 +38,9 @@ type UserServiceClient interface {
 	Logout(ctx context.Context, in *LogoutRequest, opts ...grpc.CallOption) (*LogoutResponse, error)
 	// RefreshToken atualiza o token de um usuário
 	RefreshToken(ctx context.Context, in *RefreshTokenRequest, opts ...grpc.CallOption) (*RefreshTokenResponse, error)
+	// CreateWebSocketTicket emite um ticket opaco, de uso único e curta duração,
+	// usado no lugar do token para abrir conexões WebSocket
+	CreateWebSocketTicket(ctx context.Context, in *CreateWebSocketTicketRequest, opts ...grpc.CallOption) (*CreateWebSocketTicketResponse, error)
 }
 
 type userServiceClient struct {
@@ -87,6 +91,16 @@ func (c *userServiceClient) RefreshToken(ctx context.Context, in *RefreshTokenRe
 	return out, nil
 }
 
+func (c *userServiceClient) CreateWebSocketTicket(ctx context.Context, in *CreateWebSocketTicketRequest, opts ...grpc.CallOption) (*CreateWebSocketTicketResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateWebSocketTicketResponse)
+	err := c.cc.Invoke(ctx, UserService_CreateWebSocketTicket_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility.
@@ -99,6 +113,9 @@ type UserServiceServer interface {
 	Logout(context.Context, *LogoutRequest) (*LogoutResponse, error)
 	// RefreshToken atualiza o token de um usuário
 	RefreshToken(context.Context, *RefreshTokenRequest) (*RefreshTokenResponse, error)
+	// CreateWebSocketTicket emite um ticket opaco, de uso único e curta duração,
+	// usado no lugar do token para abrir conexões WebSocket
+	CreateWebSocketTicket(context.Context, *CreateWebSocketTicketRequest) (*CreateWebSocketTicketResponse, error)
 	mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -121,6 +138,9 @@ func (UnimplementedUserServiceServer) Logout(context.Context, *LogoutRequest) (*
 func (UnimplementedUserServiceServer) RefreshToken(context.Context, *RefreshTokenRequest) (*RefreshTokenResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method RefreshToken not implemented")
 }
+func (UnimplementedUserServiceServer) CreateWebSocketTicket(context.Context, *CreateWebSocketTicketRequest) (*CreateWebSocketTicketResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateWebSocketTicket not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 func (UnimplementedUserServiceServer) testEmbeddedByValue()                     {}
 
@@ -214,6 +234,24 @@ func _UserService_RefreshToken_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_CreateWebSocketTicket_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWebSocketTicketRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).CreateWebSocketTicket(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_CreateWebSocketTicket_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).CreateWebSocketTicket(ctx, req.(*CreateWebSocketTicketRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -237,6 +275,10 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RefreshToken",
 			Handler:    _UserService_RefreshToken_Handler,
 		},
+		{
+			MethodName: "CreateWebSocketTicket",
+			Handler:    _UserService_CreateWebSocketTicket_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "user/user.proto",
@@ -0,0 +1,336 @@
+package runtimeconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[REDACTED]"
+
+// Validator is implemented by runtime config structs that need checks before
+// a new version is applied.
+type Validator interface {
+	Validate() error
+}
+
+// ApplyFunc receives the previous and the new config. Returning an error
+// aborts the reload and rolls every subscriber back to the previous config.
+type ApplyFunc[T any] func(old, next *T) error
+
+type subscription[T any] struct {
+	keys  []string
+	apply ApplyFunc[T]
+}
+
+// Store keeps the current runtime config of a service, loaded from a YAML
+// file (usually a mounted ConfigMap), and swaps it atomically on changes.
+type Store[T any] struct {
+	path     string
+	defaults T
+
+	current atomic.Pointer[T]
+
+	mu       sync.Mutex
+	hash     [sha256.Size]byte
+	rejected [sha256.Size]byte
+	subs     []subscription[T]
+	lastErr  error
+	loadedAt time.Time
+}
+
+// New creates a store with the given defaults and loads the file once. A
+// missing path keeps the defaults; an invalid file is a startup error.
+func New[T any](path string, defaults T) (*Store[T], error) {
+	s := &Store[T]{path: path, defaults: defaults}
+
+	initial := defaults
+	s.current.Store(&initial)
+	s.loadedAt = time.Now()
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the current config. The returned value must not be modified.
+func (s *Store[T]) Get() *T {
+	return s.current.Load()
+}
+
+// Subscribe registers fn to be called whenever one of the given top-level
+// keys changes, or on every change when no key is given. fn is also called
+// once right away with the current config.
+func (s *Store[T]) Subscribe(fn ApplyFunc[T], keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.current.Load()
+	if err := fn(current, current); err != nil {
+		return err
+	}
+
+	s.subs = append(s.subs, subscription[T]{keys: keys, apply: fn})
+	return nil
+}
+
+// Reload reads the file and, when its content changed, validates and applies
+// the new config. On any failure the last good config stays in place.
+func (s *Store[T]) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		s.lastErr = fmt.Errorf("reading runtime config: %w", err)
+		return s.lastErr
+	}
+
+	// A version that was already rejected is not retried until it changes.
+	hash := sha256.Sum256(content)
+	if hash == s.hash || (s.lastErr != nil && hash == s.rejected) {
+		return nil
+	}
+
+	if err := s.apply(content); err != nil {
+		s.rejected = hash
+		s.lastErr = err
+		return err
+	}
+
+	s.hash = hash
+	s.lastErr = nil
+	return nil
+}
+
+func (s *Store[T]) apply(content []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("parsing runtime config: %w", err)
+	}
+
+	next := s.defaults
+	if len(doc.Content) > 0 {
+		resetKeys(&next, doc.Content[0])
+		if err := doc.Decode(&next); err != nil {
+			return fmt.Errorf("parsing runtime config: %w", err)
+		}
+	}
+
+	if v, ok := any(&next).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("validating runtime config: %w", err)
+		}
+	}
+
+	old := s.current.Load()
+	changed := changedKeys(old, &next)
+
+	var applied []subscription[T]
+	for _, sub := range s.subs {
+		if !sub.interested(changed) {
+			continue
+		}
+		if err := sub.apply(old, &next); err != nil {
+			for _, done := range applied {
+				if rbErr := done.apply(&next, old); rbErr != nil {
+					slog.Error("runtime config rollback failed", slog.Any("error", rbErr))
+				}
+			}
+			return fmt.Errorf("applying runtime config: %w", err)
+		}
+		applied = append(applied, sub)
+	}
+
+	s.current.Store(&next)
+	s.loadedAt = time.Now()
+
+	if len(changed) > 0 {
+		slog.Info("runtime config reloaded", slog.String("changed_keys", strings.Join(changed, ",")))
+	}
+
+	return nil
+}
+
+// Watch polls the file every interval until ctx is done. Polling the content
+// instead of relying on inotify survives the symlink swap Kubernetes does
+// when a ConfigMap volume is updated.
+func (s *Store[T]) Watch(ctx context.Context, interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				slog.Warn("runtime config reload rejected, keeping last good config", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Effective returns the current values keyed by their YAML name, with fields
+// tagged `secret:"true"` redacted.
+func (s *Store[T]) Effective() map[string]any {
+	return redact(s.current.Load())
+}
+
+// Handler serves the effective config as JSON.
+func (s *Store[T]) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		s.mu.Lock()
+		body := map[string]any{
+			"source":    s.path,
+			"loaded_at": s.loadedAt.UTC().Format(time.RFC3339),
+			"values":    s.Effective(),
+		}
+		if s.lastErr != nil {
+			body["last_error"] = s.lastErr.Error()
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			slog.Error("error encoding runtime config", slog.Any("error", err))
+		}
+	})
+}
+
+func (sub subscription[T]) interested(changed []string) bool {
+	if len(changed) == 0 {
+		return false
+	}
+	if len(sub.keys) == 0 {
+		return true
+	}
+	for _, key := range sub.keys {
+		for _, c := range changed {
+			if key == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type field struct {
+	name   string
+	secret bool
+	value  reflect.Value
+}
+
+func fields(v any) ([]field, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("runtime config must be a struct")
+	}
+
+	var out []field
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out = append(out, field{
+			name:   name,
+			secret: f.Tag.Get("secret") == "true",
+			value:  rv.Field(i),
+		})
+	}
+	return out, nil
+}
+
+// resetKeys zeroes the fields of v set in the file, so that a key in the
+// file replaces its default instead of being merged into it (yaml merges
+// maps) and the maps of the defaults are never written to.
+func resetKeys(v any, mapping *yaml.Node) {
+	if mapping.Kind != yaml.MappingNode {
+		return
+	}
+	fs, err := fields(v)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		for _, f := range fs {
+			if f.name == mapping.Content[i].Value {
+				f.value.Set(reflect.Zero(f.value.Type()))
+			}
+		}
+	}
+}
+
+func changedKeys(old, next any) []string {
+	oldFields, err := fields(old)
+	if err != nil {
+		return nil
+	}
+	newFields, _ := fields(next)
+
+	var changed []string
+	for i := range newFields {
+		if !reflect.DeepEqual(oldFields[i].value.Interface(), newFields[i].value.Interface()) {
+			changed = append(changed, newFields[i].name)
+		}
+	}
+	return changed
+}
+
+func redact(v any) map[string]any {
+	fs, err := fields(v)
+	if err != nil {
+		return nil
+	}
+
+	out := make(map[string]any, len(fs))
+	for _, f := range fs {
+		switch {
+		case f.secret:
+			out[f.name] = redacted
+		case f.value.Type() == reflect.TypeOf(time.Duration(0)):
+			out[f.name] = time.Duration(f.value.Int()).String()
+		default:
+			out[f.name] = f.value.Interface()
+		}
+	}
+	return out
+}
@@ -0,0 +1,17 @@
+package session
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RevocationChannel is the Redis pub/sub channel on which user-service
+// publishes the ID of a user whenever their session changes (login, logout,
+// refresh or revocation), so caches of the previous session can drop it.
+const RevocationChannel = "session:revocations"
+
+// PublishRevocation announces that the session of userID changed.
+func PublishRevocation(ctx context.Context, rdb redis.Cmdable, userID string) error {
+	return rdb.Publish(ctx, RevocationChannel, userID).Err()
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const ticketPrefix = "ws_ticket:"
+
+// Ticket is what a WebSocket ticket stands for: the session it was issued
+// from. Redeeming it still requires that session to be active.
+type Ticket struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role,omitempty"`
+	JTI    string `json:"jti"`
+}
+
+// IssueTicket stores t under a new random ticket valid for ttl. Tickets are
+// opaque and single use, so unlike access tokens they are safe to send in a
+// query string, where browsers put WebSocket credentials.
+func IssueTicket(ctx context.Context, rdb redis.Cmdable, t Ticket, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(raw)
+
+	content, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	if err := rdb.Set(ctx, ticketPrefix+ticket, content, ttl).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// RedeemTicket consumes ticket. It reports false for unknown, expired or
+// already redeemed tickets.
+func RedeemTicket(ctx context.Context, rdb redis.Cmdable, ticket string) (Ticket, bool, error) {
+	content, err := rdb.GetDel(ctx, ticketPrefix+ticket).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Ticket{}, false, nil
+	}
+	if err != nil {
+		return Ticket{}, false, err
+	}
+
+	var t Ticket
+	if err := json.Unmarshal(content, &t); err != nil {
+		return Ticket{}, false, fmt.Errorf("decoding ws ticket: %w", err)
+	}
+	return t, true, nil
+}
@@ -1,6 +1,9 @@
 package types
 
-import userpb "ms-ride-sharing/shared/proto/v1/user"
+import (
+	userpb "ms-ride-sharing/shared/proto/v1/user"
+	"sort"
+)
 
 type UserType string
 
@@ -30,3 +33,16 @@ func MapProtoToUserTypeDomain(t userpb.UserType) UserType {
 		return PASSENGER
 	}
 }
+
+// Roles are the user type names carried in access tokens and used in
+// (ridesharing.auth) rules.
+func Roles() []string {
+	var roles []string
+	for name, value := range userpb.UserType_value {
+		if value != int32(userpb.UserType_UNSPECIFIED) {
+			roles = append(roles, name)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}